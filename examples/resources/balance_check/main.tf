@@ -0,0 +1,39 @@
+terraform {
+  required_providers {
+    grid = {
+      source = "threefoldtech/grid"
+    }
+  }
+}
+
+provider "grid" {
+}
+
+data "grid_twin" "me" {
+}
+
+data "grid_balance" "me" {
+}
+
+# fail the plan early if the account can't pay for the deployment
+resource "grid_network" "net" {
+  nodes       = [1]
+  ip_range    = "10.1.0.0/16"
+  name        = "network"
+  description = "network owned by twin ${data.grid_twin.me.twin_id}"
+
+  lifecycle {
+    precondition {
+      condition     = data.grid_balance.me.free > 10
+      error_message = "account ${data.grid_balance.me.account_address} needs at least 10 TFT to deploy"
+    }
+  }
+}
+
+output "twin_id" {
+  value = data.grid_twin.me.twin_id
+}
+
+output "free_balance" {
+  value = data.grid_balance.me.free
+}
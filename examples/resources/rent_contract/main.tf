@@ -0,0 +1,35 @@
+terraform {
+  required_providers {
+    grid = {
+      source = "threefoldtech/grid"
+    }
+  }
+}
+
+provider "grid" {
+}
+
+# rent a dedicated node on farm 1 with at least 8 cpus and 16 GB of memory
+resource "grid_rent_contract" "rent" {
+  farm_id = 1
+  cru     = 8
+  mru     = 16384
+}
+
+# deploy on the rented node
+resource "grid_scheduler" "sched" {
+  requests {
+    name         = "vm"
+    cru          = 2
+    mru          = 2048
+    rented_by_me = true
+  }
+  depends_on = [grid_rent_contract.rent]
+}
+
+output "rented_node" {
+  value = grid_rent_contract.rent.node
+}
+output "contract_id" {
+  value = grid_rent_contract.rent.contract_id
+}
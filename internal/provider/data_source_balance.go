@@ -0,0 +1,79 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+)
+
+// tftUnits is the number of balance units in one TFT
+const tftUnits = 1e7
+
+func dataSourceBalance() *schema.Resource {
+	return &schema.Resource{
+		Description: "Data source for reading the TFT balance of the account the provider is configured with, e.g. to check it in a `precondition` before deploying.",
+
+		ReadContext: dataSourceBalanceRead,
+
+		Schema: map[string]*schema.Schema{
+			"account_address": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "SS58 address of the configured account.",
+			},
+			"free": {
+				Type:        schema.TypeFloat,
+				Computed:    true,
+				Description: "Free balance in TFT.",
+			},
+			"reserved": {
+				Type:        schema.TypeFloat,
+				Computed:    true,
+				Description: "Reserved balance in TFT.",
+			},
+		},
+	}
+}
+
+func dataSourceBalanceRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	balance, err := tfPluginClient.SubstrateConn.GetBalance(tfPluginClient.Identity)
+	if err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't get account balance"))
+	}
+
+	if err := d.Set("account_address", tfPluginClient.Identity.Address()); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("free", toTFT(balance.Free)); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("reserved", toTFT(balance.Reserved)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(strconv.FormatInt(time.Now().Unix(), 10))
+	return nil
+}
+
+// toTFT converts a balance in units to TFT
+func toTFT(amount types.U128) float64 {
+	if amount.Int == nil {
+		return 0
+	}
+	tft, _ := new(big.Float).Quo(new(big.Float).SetInt(amount.Int), big.NewFloat(tftUnits)).Float64()
+	return tft
+}
@@ -0,0 +1,14 @@
+package provider
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToTFT(t *testing.T) {
+	assert.Equal(t, 12.5, toTFT(types.NewU128(*big.NewInt(125000000))))
+	assert.Equal(t, float64(0), toTFT(types.U128{}))
+}
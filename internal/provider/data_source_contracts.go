@@ -0,0 +1,245 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func dataSourceContracts() *schema.Resource {
+	return &schema.Resource{
+		Description: "Data source for listing the node, name, and rent contracts of the configured twin, and reporting the orphan contracts which aren't referenced by the configuration, e.g. contracts left behind by failed applies.",
+
+		ReadContext: dataSourceContractsRead,
+
+		Schema: map[string]*schema.Schema{
+			"states": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice([]string{"Created", "GracePeriod", "Deleted", "OutOfFunds"}, false),
+				},
+				Description: "States of the contracts to list, defaults to Created and GracePeriod.",
+			},
+			"referenced_contract_ids": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "Ids of the contracts referenced by the configuration, e.g. the ids of its deployments, the `node_deployment_id` values of its networks, and the `name_contract_id` of its name proxies. The listed contracts which aren't referenced are reported as orphans.",
+			},
+			"project_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only report the node contracts whose deployment metadata has the given project name as orphans, so that the contracts of other projects of the twin aren't reported.",
+			},
+			"contract_ids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "Ids of the listed contracts.",
+			},
+			"contracts": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The listed contracts.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"contract_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Contract id.",
+						},
+						"type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Contract type, one of: node, name, rent.",
+						},
+						"state": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Contract state.",
+						},
+						"created_at": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Unix timestamp of the contract creation.",
+						},
+						"node": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Node id of node and rent contracts.",
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of name contracts.",
+						},
+						"public_ips": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Number of public ips of node contracts.",
+						},
+						"solution_type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Solution type from the deployment metadata of node contracts.",
+						},
+						"solution_name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Solution name from the deployment metadata of node contracts.",
+						},
+						"project_name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Project name from the deployment metadata of node contracts.",
+						},
+					},
+				},
+			},
+			"orphans": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "Ids of the listed contracts that aren't in `referenced_contract_ids`, and belong to the project named `project_name` if set.",
+			},
+		},
+	}
+}
+
+func dataSourceContractsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	states := []string{"Created", "GracePeriod"}
+	if configured := d.Get("states").([]interface{}); len(configured) != 0 {
+		states = states[:0]
+		for _, state := range configured {
+			states = append(states, state.(string))
+		}
+	}
+	twinID := uint64(tfPluginClient.TwinID)
+	contracts := []proxyTypes.Contract{}
+	for _, state := range states {
+		for page := uint64(1); ; page++ {
+			res, _, err := tfPluginClient.GridProxyClient.Contracts(proxyTypes.ContractFilter{
+				TwinID: &twinID,
+				State:  &state,
+			}, proxyTypes.Limit{
+				Page: page,
+				Size: gridProxyPageSize,
+			})
+			if err != nil {
+				return diag.FromErr(errors.Wrapf(err, "couldn't list %s contracts from the grid proxy", state))
+			}
+			contracts = append(contracts, res...)
+			if len(res) < gridProxyPageSize {
+				break
+			}
+		}
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].ContractID < contracts[j].ContractID })
+
+	contractIDs := make([]int, 0, len(contracts))
+	for _, contract := range contracts {
+		contractIDs = append(contractIDs, int(contract.ContractID))
+	}
+	if err := d.Set("contract_ids", contractIDs); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set contract ids"))
+	}
+	if err := d.Set("contracts", flattenContracts(contracts)); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set contracts"))
+	}
+
+	referenced := map[uint64]bool{}
+	for _, id := range d.Get("referenced_contract_ids").([]interface{}) {
+		referenced[uint64(id.(int))] = true
+	}
+	orphans := orphanContracts(contracts, referenced, d.Get("project_name").(string))
+	if err := d.Set("orphans", orphans); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set orphan contracts"))
+	}
+
+	d.SetId(strconv.FormatInt(time.Now().Unix(), 10))
+	return nil
+}
+
+func flattenContracts(contracts []proxyTypes.Contract) []map[string]interface{} {
+	res := make([]map[string]interface{}, 0, len(contracts))
+	for _, contract := range contracts {
+		c := map[string]interface{}{
+			"contract_id": int(contract.ContractID),
+			"type":        contract.Type,
+			"state":       contract.State,
+			"created_at":  int(contract.CreatedAt),
+		}
+		switch details := contract.Details.(type) {
+		case proxyTypes.NodeContractDetails:
+			c["node"] = int(details.NodeID)
+			c["public_ips"] = int(details.NumberOfPublicIps)
+			if metadata, ok := deploymentMetadata(details); ok {
+				c["solution_type"] = metadata.Type
+				c["solution_name"] = metadata.Name
+				c["project_name"] = metadata.ProjectName
+			}
+		case proxyTypes.NameContractDetails:
+			c["name"] = details.Name
+		case proxyTypes.RentContractDetails:
+			c["node"] = int(details.NodeID)
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// contractMetadata is the metadata set by the deployer in the deployment data of node contracts
+type contractMetadata struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	ProjectName string `json:"projectName"`
+}
+
+// deploymentMetadata parses the node contract's deployment data, it's ignored if it isn't json
+func deploymentMetadata(details proxyTypes.NodeContractDetails) (contractMetadata, bool) {
+	var metadata contractMetadata
+	if err := json.Unmarshal([]byte(details.DeploymentData), &metadata); err != nil {
+		return contractMetadata{}, false
+	}
+	return metadata, true
+}
+
+// orphanContracts returns the ids of the contracts which aren't referenced,
+// only node contracts of the given project are considered if a project name is given
+func orphanContracts(contracts []proxyTypes.Contract, referenced map[uint64]bool, projectName string) []int {
+	orphans := []int{}
+	for _, contract := range contracts {
+		if referenced[uint64(contract.ContractID)] {
+			continue
+		}
+		if projectName != "" {
+			details, ok := contract.Details.(proxyTypes.NodeContractDetails)
+			if !ok {
+				continue
+			}
+			if metadata, ok := deploymentMetadata(details); !ok || metadata.ProjectName != projectName {
+				continue
+			}
+		}
+		orphans = append(orphans, int(contract.ContractID))
+	}
+	return orphans
+}
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func TestFlattenContracts(t *testing.T) {
+	contracts := flattenContracts([]proxyTypes.Contract{
+		{ContractID: 1, Type: "node", State: "Created", Details: proxyTypes.NodeContractDetails{
+			NodeID:         11,
+			DeploymentData: `{"type":"vm","name":"vm1","projectName":"project"}`,
+		}},
+		{ContractID: 2, Type: "name", State: "GracePeriod", Details: proxyTypes.NameContractDetails{Name: "gw"}},
+		{ContractID: 3, Type: "rent", State: "Created", Details: proxyTypes.RentContractDetails{NodeID: 12}},
+	})
+	assert.Len(t, contracts, 3)
+	assert.Equal(t, 11, contracts[0]["node"])
+	assert.Equal(t, "vm", contracts[0]["solution_type"])
+	assert.Equal(t, "project", contracts[0]["project_name"])
+	assert.Equal(t, "gw", contracts[1]["name"])
+	assert.Equal(t, 12, contracts[2]["node"])
+}
+
+func TestOrphanContracts(t *testing.T) {
+	contracts := []proxyTypes.Contract{
+		{ContractID: 1, Details: proxyTypes.NodeContractDetails{DeploymentData: `{"projectName":"app"}`}},
+		{ContractID: 2, Details: proxyTypes.NodeContractDetails{DeploymentData: `{"projectName":"app"}`}},
+		{ContractID: 3, Details: proxyTypes.NodeContractDetails{DeploymentData: `{"projectName":"other"}`}},
+		{ContractID: 4, Details: proxyTypes.NodeContractDetails{DeploymentData: "not json"}},
+		{ContractID: 5, Details: proxyTypes.NameContractDetails{Name: "gw"}},
+	}
+	referenced := map[uint64]bool{1: true}
+	assert.Equal(t, []int{2, 3, 4, 5}, orphanContracts(contracts, referenced, ""))
+	assert.Equal(t, []int{2}, orphanContracts(contracts, referenced, "app"))
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, orphanContracts(contracts, map[uint64]bool{}, ""))
+}
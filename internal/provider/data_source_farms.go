@@ -0,0 +1,200 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/terraform-provider-grid/internal/provider/scheduler"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func dataSourceFarms() *schema.Resource {
+	return &schema.Resource{
+		Description: "Data source for listing the grid farms satisfying the given filters.",
+
+		ReadContext: dataSourceFarmsRead,
+
+		Schema: map[string]*schema.Schema{
+			"farm_id": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Farm id.",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Farm name.",
+			},
+			"name_contains": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Part of the farm name.",
+			},
+			"twin_id": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Twin id of the farmer.",
+			},
+			"certification_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Certification type of the farms, one of: NotCertified, Gold.",
+			},
+			"pricing_policy_id": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Pricing policy id of the farms.",
+			},
+			"free_ips": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum number of free public ips.",
+			},
+			"dedicated": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only dedicated farms, false to list only shared farms.",
+			},
+			"limit": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     gridProxyPageSize,
+				Description: "Maximum number of farms to list.",
+			},
+			"farm_ids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "Ids of the listed farms.",
+			},
+			"farms": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The listed farms.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"farm_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Farm id.",
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Farm name.",
+						},
+						"twin_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Twin id of the farmer.",
+						},
+						"certification_type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Certification type of the farm.",
+						},
+						"pricing_policy_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Pricing policy id of the farm.",
+						},
+						"dedicated": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "True if the farm is dedicated.",
+						},
+						"free_ips": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Number of free public ips.",
+						},
+						"total_ips": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Total number of public ips.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceFarmsRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	filter := farmsFilter(d)
+	limit := d.Get("limit").(int)
+	farms := []proxyTypes.Farm{}
+	for page := uint64(1); len(farms) < limit; page++ {
+		res, _, err := tfPluginClient.GridProxyClient.Farms(filter, proxyTypes.Limit{
+			Page: page,
+			Size: gridProxyPageSize,
+		})
+		if err != nil {
+			return diag.FromErr(errors.Wrap(err, "couldn't list farms from the grid proxy"))
+		}
+		farms = append(farms, res...)
+		if len(res) < gridProxyPageSize {
+			break
+		}
+	}
+	if len(farms) > limit {
+		farms = farms[:limit]
+	}
+
+	farmIDs := make([]int, 0, len(farms))
+	for _, farm := range farms {
+		farmIDs = append(farmIDs, farm.FarmID)
+	}
+	if err := d.Set("farm_ids", farmIDs); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set farm ids"))
+	}
+	if err := d.Set("farms", flattenFarms(farms)); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set farms"))
+	}
+
+	d.SetId(strconv.FormatInt(time.Now().Unix(), 10))
+	return nil
+}
+
+// farmsFilter builds the grid proxy filter from the data source's configuration
+func farmsFilter(d *schema.ResourceData) proxyTypes.FarmFilter {
+	return proxyTypes.FarmFilter{
+		FarmID:            optionalUint(d, "farm_id", 1),
+		Name:              optionalString(d, "name"),
+		NameContains:      optionalString(d, "name_contains"),
+		TwinID:            optionalUint(d, "twin_id", 1),
+		CertificationType: optionalString(d, "certification_type"),
+		PricingPolicyID:   optionalUint(d, "pricing_policy_id", 1),
+		FreeIPs:           optionalUint(d, "free_ips", 1),
+		Dedicated:         optionalBool(d, "dedicated"),
+	}
+}
+
+func flattenFarms(farms []proxyTypes.Farm) []map[string]interface{} {
+	res := make([]map[string]interface{}, 0, len(farms))
+	for _, farm := range farms {
+		res = append(res, map[string]interface{}{
+			"farm_id":            farm.FarmID,
+			"name":               farm.Name,
+			"twin_id":            farm.TwinID,
+			"certification_type": farm.CertificationType,
+			"pricing_policy_id":  farm.PricingPolicyID,
+			"dedicated":          farm.Dedicated,
+			"free_ips":           int(scheduler.GetPublicIPsCount(farm.PublicIps)),
+			"total_ips":          len(farm.PublicIps),
+		})
+	}
+	return res
+}
@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func TestFarmsFilter(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceFarms().Schema, map[string]interface{}{
+		"name_contains": "free",
+		"free_ips":      2,
+	})
+	filter := farmsFilter(d)
+	assert.Equal(t, *filter.NameContains, "free")
+	assert.Equal(t, *filter.FreeIPs, uint64(2))
+	assert.Nil(t, filter.FarmID)
+	assert.Nil(t, filter.Dedicated)
+}
+
+func TestFlattenFarms(t *testing.T) {
+	farms := flattenFarms([]proxyTypes.Farm{{
+		FarmID: 1,
+		Name:   "freefarm",
+		PublicIps: []proxyTypes.PublicIP{
+			{IP: "1.1.1.1/24"},
+			{IP: "1.1.1.2/24", ContractID: 5},
+		},
+	}})
+	assert.Len(t, farms, 1)
+	assert.Equal(t, farms[0]["name"], "freefarm")
+	assert.Equal(t, farms[0]["free_ips"], 1)
+	assert.Equal(t, farms[0]["total_ips"], 2)
+}
@@ -0,0 +1,380 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// gridProxyPageSize is the page size used by the data sources listing from the grid proxy
+const gridProxyPageSize = 50
+
+func dataSourceNodes() *schema.Resource {
+	return &schema.Resource{
+		Description: "Data source for listing the grid nodes satisfying the given filters.",
+
+		ReadContext: dataSourceNodesRead,
+
+		Schema: map[string]*schema.Schema{
+			"status": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Node status, one of: up, down, standby.",
+			},
+			"farm_ids": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "List of farm ids the nodes belong to.",
+			},
+			"free_mru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum free memory size in MBs.",
+			},
+			"free_sru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum free SSD size in MBs.",
+			},
+			"free_hru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum free HDD size in MBs.",
+			},
+			"total_cru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum number of virtual CPUs.",
+			},
+			"free_ips": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Minimum number of free public ips on the nodes' farm.",
+			},
+			"country": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Country name of the nodes.",
+			},
+			"city": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "City name of the nodes.",
+			},
+			"domain": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only nodes with a domain in their public config, false to list only nodes without.",
+			},
+			"ipv4": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only nodes with a public ipv4 in their public config, false to list only nodes without.",
+			},
+			"ipv6": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only nodes with a public ipv6 in their public config, false to list only nodes without.",
+			},
+			"dedicated": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only dedicated nodes, false to list only shared nodes.",
+			},
+			"rentable": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only dedicated nodes that aren't rented.",
+			},
+			"rented": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "True to list only rented nodes, false to list only nodes that aren't rented.",
+			},
+			"rented_by": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Twin id the nodes are rented by.",
+			},
+			"available_for": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Description: "Twin id the nodes are available for, that is nodes that aren't rented, or rented by this twin.",
+			},
+			"certification_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Certification type of the nodes, one of: Diy, Certified.",
+			},
+			"limit": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     gridProxyPageSize,
+				Description: "Maximum number of nodes to list.",
+			},
+			"node_ids": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Description: "Ids of the listed nodes.",
+			},
+			"nodes": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The listed nodes.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"node_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Node id.",
+						},
+						"farm_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Farm id of the node.",
+						},
+						"twin_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Twin id of the node.",
+						},
+						"status": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Node status.",
+						},
+						"certification_type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Certification type of the node.",
+						},
+						"dedicated": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "True if the node is dedicated.",
+						},
+						"rented_by_twin_id": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Twin id the node is rented by, zero if not rented.",
+						},
+						"country": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Country of the node.",
+						},
+						"city": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "City of the node.",
+						},
+						"total_cru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Total number of virtual CPUs.",
+						},
+						"used_cru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Used number of virtual CPUs.",
+						},
+						"total_mru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Total memory size in MBs.",
+						},
+						"used_mru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Used memory size in MBs.",
+						},
+						"total_sru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Total SSD size in MBs.",
+						},
+						"used_sru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Used SSD size in MBs.",
+						},
+						"total_hru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Total HDD size in MBs.",
+						},
+						"used_hru": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Used HDD size in MBs.",
+						},
+						"domain": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Domain of the node's public config.",
+						},
+						"ipv4": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Public ipv4 of the node's public config.",
+						},
+						"ipv6": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Public ipv6 of the node's public config.",
+						},
+						"gw4": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Ipv4 gateway of the node's public config.",
+						},
+						"gw6": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Ipv6 gateway of the node's public config.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceNodesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	filter := nodesFilter(d)
+	limit := d.Get("limit").(int)
+	nodes := []proxyTypes.Node{}
+	for page := uint64(1); len(nodes) < limit; page++ {
+		res, _, err := tfPluginClient.GridProxyClient.Nodes(filter, proxyTypes.Limit{
+			Page: page,
+			Size: gridProxyPageSize,
+		})
+		if err != nil {
+			return diag.FromErr(errors.Wrap(err, "couldn't list nodes from the grid proxy"))
+		}
+		nodes = append(nodes, res...)
+		if len(res) < gridProxyPageSize {
+			break
+		}
+	}
+	if len(nodes) > limit {
+		nodes = nodes[:limit]
+	}
+
+	nodeIDs := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		nodeIDs = append(nodeIDs, node.NodeID)
+	}
+	if err := d.Set("node_ids", nodeIDs); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set node ids"))
+	}
+	if err := d.Set("nodes", flattenNodes(nodes)); err != nil {
+		return diag.FromErr(errors.Wrap(err, "couldn't set nodes"))
+	}
+
+	d.SetId(strconv.FormatInt(time.Now().Unix(), 10))
+	return nil
+}
+
+// nodesFilter builds the grid proxy filter from the data source's configuration
+func nodesFilter(d *schema.ResourceData) proxyTypes.NodeFilter {
+	filter := proxyTypes.NodeFilter{
+		Status:            optionalString(d, "status"),
+		Country:           optionalString(d, "country"),
+		City:              optionalString(d, "city"),
+		CertificationType: optionalString(d, "certification_type"),
+		TotalCRU:          optionalUint(d, "total_cru", 1),
+		FreeMRU:           optionalUint(d, "free_mru", uint64(gridtypes.Megabyte)),
+		FreeSRU:           optionalUint(d, "free_sru", uint64(gridtypes.Megabyte)),
+		FreeHRU:           optionalUint(d, "free_hru", uint64(gridtypes.Megabyte)),
+		FreeIPs:           optionalUint(d, "free_ips", 1),
+		RentedBy:          optionalUint(d, "rented_by", 1),
+		AvailableFor:      optionalUint(d, "available_for", 1),
+		Domain:            optionalBool(d, "domain"),
+		IPv4:              optionalBool(d, "ipv4"),
+		IPv6:              optionalBool(d, "ipv6"),
+		Dedicated:         optionalBool(d, "dedicated"),
+		Rentable:          optionalBool(d, "rentable"),
+		Rented:            optionalBool(d, "rented"),
+	}
+	for _, id := range d.Get("farm_ids").([]interface{}) {
+		filter.FarmIDs = append(filter.FarmIDs, uint64(id.(int)))
+	}
+	return filter
+}
+
+func optionalString(d *schema.ResourceData, key string) *string {
+	value, ok := d.GetOk(key)
+	if !ok {
+		return nil
+	}
+	s := value.(string)
+	return &s
+}
+
+// optionalUint returns the attribute's value multiplied by the given unit, or nil if it isn't set
+func optionalUint(d *schema.ResourceData, key string, unit uint64) *uint64 {
+	value, ok := d.GetOk(key)
+	if !ok {
+		return nil
+	}
+	u := uint64(value.(int)) * unit
+	return &u
+}
+
+// optionalBool returns the attribute's value if it's set in the configuration, as false values are meaningful filters
+func optionalBool(d *schema.ResourceData, key string) *bool {
+	config := d.GetRawConfig()
+	if config.IsNull() || config.GetAttr(key).IsNull() {
+		return nil
+	}
+	b := config.GetAttr(key).True()
+	return &b
+}
+
+func flattenNodes(nodes []proxyTypes.Node) []map[string]interface{} {
+	res := make([]map[string]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, map[string]interface{}{
+			"node_id":            node.NodeID,
+			"farm_id":            node.FarmID,
+			"twin_id":            node.TwinID,
+			"status":             node.Status,
+			"certification_type": node.CertificationType,
+			"dedicated":          node.Dedicated,
+			"rented_by_twin_id":  int(node.RentedByTwinID),
+			"country":            node.Country,
+			"city":               node.City,
+			"total_cru":          int(node.TotalResources.CRU),
+			"used_cru":           int(node.UsedResources.CRU),
+			"total_mru":          int(node.TotalResources.MRU / gridtypes.Megabyte),
+			"used_mru":           int(node.UsedResources.MRU / gridtypes.Megabyte),
+			"total_sru":          int(node.TotalResources.SRU / gridtypes.Megabyte),
+			"used_sru":           int(node.UsedResources.SRU / gridtypes.Megabyte),
+			"total_hru":          int(node.TotalResources.HRU / gridtypes.Megabyte),
+			"used_hru":           int(node.UsedResources.HRU / gridtypes.Megabyte),
+			"domain":             node.PublicConfig.Domain,
+			"ipv4":               node.PublicConfig.Ipv4,
+			"ipv6":               node.PublicConfig.Ipv6,
+			"gw4":                node.PublicConfig.Gw4,
+			"gw6":                node.PublicConfig.Gw6,
+		})
+	}
+	return res
+}
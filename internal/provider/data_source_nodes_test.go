@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestNodesFilter(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceNodes().Schema, map[string]interface{}{
+		"status":    "up",
+		"farm_ids":  []interface{}{1, 2},
+		"free_mru":  1024,
+		"total_cru": 2,
+		"rented_by": 7,
+	})
+	filter := nodesFilter(d)
+	assert.Equal(t, *filter.Status, "up")
+	assert.Equal(t, filter.FarmIDs, []uint64{1, 2})
+	assert.Equal(t, *filter.FreeMRU, uint64(1024*gridtypes.Megabyte))
+	assert.Equal(t, *filter.TotalCRU, uint64(2))
+	assert.Equal(t, *filter.RentedBy, uint64(7))
+	assert.Nil(t, filter.FreeSRU)
+	assert.Nil(t, filter.Country)
+	assert.Nil(t, filter.IPv4)
+}
+
+func TestFlattenNodes(t *testing.T) {
+	nodes := flattenNodes([]proxyTypes.Node{{
+		NodeID:         11,
+		FarmID:         1,
+		TotalResources: proxyTypes.Capacity{CRU: 4, MRU: 8 * gridtypes.Gigabyte},
+		UsedResources:  proxyTypes.Capacity{CRU: 1, MRU: gridtypes.Gigabyte},
+		PublicConfig:   proxyTypes.PublicConfig{Ipv6: "::1"},
+	}})
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, nodes[0]["node_id"], 11)
+	assert.Equal(t, nodes[0]["total_mru"], 8192)
+	assert.Equal(t, nodes[0]["used_mru"], 1024)
+	assert.Equal(t, nodes[0]["used_cru"], 1)
+	assert.Equal(t, nodes[0]["ipv6"], "::1")
+}
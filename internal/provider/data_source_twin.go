@@ -0,0 +1,87 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+)
+
+// twinGetter is implemented by the substrate connection, but isn't part of subi.SubstrateExt
+type twinGetter interface {
+	GetTwin(id uint32) (*substrate.Twin, error)
+}
+
+func dataSourceTwin() *schema.Resource {
+	return &schema.Resource{
+		Description: "Data source for reading the twin and account the provider is configured with.",
+
+		ReadContext: dataSourceTwinRead,
+
+		Schema: map[string]*schema.Schema{
+			"twin_id": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "Twin id of the configured account.",
+			},
+			"account_address": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "SS58 address of the configured account.",
+			},
+			"public_key": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Hex encoded public key of the configured account.",
+			},
+			"relay": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Relay registered for the twin on the chain.",
+			},
+		},
+	}
+}
+
+func dataSourceTwinRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+	sub, ok := tfPluginClient.SubstrateConn.(twinGetter)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("substrate connection doesn't support getting twins"))
+	}
+
+	twin, err := sub.GetTwin(tfPluginClient.TwinID)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't get twin %d", tfPluginClient.TwinID))
+	}
+	relay := ""
+	if twin.Relay.HasValue {
+		relay = twin.Relay.AsValue
+	}
+
+	if err := d.Set("twin_id", int(tfPluginClient.TwinID)); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("account_address", tfPluginClient.Identity.Address()); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("public_key", hex.EncodeToString(tfPluginClient.Identity.PublicKey())); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("relay", relay); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(strconv.FormatUint(uint64(tfPluginClient.TwinID), 10))
+	return nil
+}
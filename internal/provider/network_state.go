@@ -0,0 +1,203 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+	"golang.org/x/sync/errgroup"
+)
+
+// networkStateConcurrency is the number of nodes whose deployments are fetched concurrently
+const networkStateConcurrency = 8
+
+// rebuildNetworkState reports whether the networks are rebuilt from the grid, as it fetches all the twin's deployments
+func rebuildNetworkState(optedIn, recovered bool, networks state.NetworkState) bool {
+	return optedIn || recovered || len(networks) == 0
+}
+
+// syncNetworkState rebuilds the networks' subnets and host ids used by the twin's deployments on the grid in the given network state,
+// so that the local state is only a cache of them. Deployments on unreachable nodes are reported in the returned error,
+// and their cached entries are kept unless their contracts no longer exist.
+func syncNetworkState(ctx context.Context, tfPluginClient *deployer.TFPluginClient, networks state.NetworkState) error {
+	nodeContracts, err := twinNodeContracts(tfPluginClient)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var errs error
+	deployments := map[uint32][]gridtypes.Deployment{}
+	failed := map[uint32]bool{}
+	g := errgroup.Group{}
+	g.SetLimit(networkStateConcurrency)
+	for nodeID, contractIDs := range nodeContracts {
+		nodeID, contractIDs := nodeID, contractIDs
+		g.Go(func() error {
+			dls, err := nodeDeployments(ctx, tfPluginClient, nodeID, contractIDs)
+			mu.Lock()
+			defer mu.Unlock()
+			deployments[nodeID] = dls
+			if err != nil {
+				failed[nodeID] = true
+				errs = multierror.Append(errs, err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	pruneNetworkState(networks, nodeContracts, failed)
+	addNetworkState(networks, networkStateFromDeployments(deployments))
+	return errs
+}
+
+// twinNodeContracts lists the ids of the twin's active node contracts on each node
+func twinNodeContracts(tfPluginClient *deployer.TFPluginClient) (map[uint32][]uint64, error) {
+	twinID := uint64(tfPluginClient.TwinID)
+	contractType := "node"
+	nodeContracts := map[uint32][]uint64{}
+	for _, contractState := range []string{"Created", "GracePeriod"} {
+		for page := uint64(1); ; page++ {
+			contracts, _, err := tfPluginClient.GridProxyClient.Contracts(proxyTypes.ContractFilter{
+				TwinID: &twinID,
+				Type:   &contractType,
+				State:  &contractState,
+			}, proxyTypes.Limit{
+				Page: page,
+				Size: gridProxyPageSize,
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't list node contracts from the grid proxy")
+			}
+			for _, contract := range contracts {
+				details, ok := contract.Details.(proxyTypes.NodeContractDetails)
+				if !ok {
+					continue
+				}
+				nodeID := uint32(details.NodeID)
+				nodeContracts[nodeID] = append(nodeContracts[nodeID], uint64(contract.ContractID))
+			}
+			if len(contracts) < gridProxyPageSize {
+				break
+			}
+		}
+	}
+	return nodeContracts, nil
+}
+
+// nodeDeployments gets the deployments of the given contracts from the node
+func nodeDeployments(ctx context.Context, tfPluginClient *deployer.TFPluginClient, nodeID uint32, contractIDs []uint64) ([]gridtypes.Deployment, error) {
+	nodeClient, err := tfPluginClient.NcPool.GetNodeClient(tfPluginClient.SubstrateConn, nodeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get node client %d", nodeID)
+	}
+	deployments := []gridtypes.Deployment{}
+	for _, contractID := range contractIDs {
+		dl, err := nodeClient.DeploymentGet(ctx, contractID)
+		if err != nil {
+			return deployments, errors.Wrapf(err, "couldn't get deployment %d from node %d", contractID, nodeID)
+		}
+		deployments = append(deployments, dl)
+	}
+	return deployments, nil
+}
+
+// networkStateFromDeployments builds the networks' subnets from their znet workloads,
+// and the host ids used on them from the virtual machines' interfaces
+func networkStateFromDeployments(deployments map[uint32][]gridtypes.Deployment) state.NetworkState {
+	networks := state.NetworkState{}
+	for nodeID, dls := range deployments {
+		for _, dl := range dls {
+			hostIDs := map[string][]byte{}
+			for _, wl := range dl.Workloads {
+				if wl.Result.State == gridtypes.StateDeleted {
+					continue
+				}
+				data, err := wl.WorkloadData()
+				if err != nil {
+					continue
+				}
+				switch data := data.(type) {
+				case *zos.Network:
+					network := networks.GetNetwork(string(wl.Name))
+					network.SetNodeSubnet(nodeID, data.Subnet.String())
+				case *zos.ZMachine:
+					for _, iface := range data.Network.Interfaces {
+						if ip := iface.IP.To4(); ip != nil {
+							hostIDs[string(iface.Network)] = append(hostIDs[string(iface.Network)], ip[3])
+						}
+					}
+				}
+			}
+			for name, ids := range hostIDs {
+				network := networks.GetNetwork(name)
+				network.SetDeploymentHostIDs(nodeID, dl.ContractID, ids)
+			}
+		}
+	}
+	return networks
+}
+
+// addNetworkState adds the subnets and host ids of the remote networks to the cached ones, overriding them if they differ
+func addNetworkState(cached, remote state.NetworkState) {
+	for name, remoteNetwork := range remote {
+		network := cached.GetNetwork(name)
+		if network.Subnets == nil {
+			network.Subnets = map[uint32]string{}
+		}
+		if network.NodeDeploymentHostIDs == nil {
+			network.NodeDeploymentHostIDs = state.NodeDeploymentHostIDs{}
+		}
+		for nodeID, subnet := range remoteNetwork.Subnets {
+			network.SetNodeSubnet(nodeID, subnet)
+		}
+		for nodeID, deployments := range remoteNetwork.NodeDeploymentHostIDs {
+			for contractID, ids := range deployments {
+				network.SetDeploymentHostIDs(nodeID, contractID, ids)
+			}
+		}
+		cached[name] = network
+	}
+}
+
+// pruneNetworkState removes the cached entries which no longer exist on the grid. The entries of the nodes whose deployments
+// were all fetched are removed, as they're added back from the grid, while only the host ids of the deployments whose contracts
+// ended are removed on the failed nodes. Networks left without entries are removed.
+func pruneNetworkState(cached state.NetworkState, nodeContracts map[uint32][]uint64, failed map[uint32]bool) {
+	for name, network := range cached {
+		for nodeID := range network.Subnets {
+			if !failed[nodeID] {
+				delete(network.Subnets, nodeID)
+			}
+		}
+		for nodeID, deployments := range network.NodeDeploymentHostIDs {
+			if !failed[nodeID] {
+				delete(network.NodeDeploymentHostIDs, nodeID)
+				continue
+			}
+			active := map[uint64]bool{}
+			for _, contractID := range nodeContracts[nodeID] {
+				active[contractID] = true
+			}
+			for contractID := range deployments {
+				if !active[contractID] {
+					delete(deployments, contractID)
+				}
+			}
+			if len(deployments) == 0 {
+				delete(network.NodeDeploymentHostIDs, nodeID)
+			}
+		}
+		if len(network.Subnets) == 0 && len(network.NodeDeploymentHostIDs) == 0 {
+			delete(cached, name)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+	"github.com/threefoldtech/zos/pkg/gridtypes/zos"
+)
+
+func TestNetworkStateFromDeployments(t *testing.T) {
+	network := gridtypes.Workload{
+		Name: "net",
+		Type: zos.NetworkType,
+		Data: gridtypes.MustMarshal(zos.Network{
+			NetworkIPRange: gridtypes.MustParseIPNet("10.1.0.0/16"),
+			Subnet:         gridtypes.MustParseIPNet("10.1.2.0/24"),
+		}),
+	}
+	vm := gridtypes.Workload{
+		Name: "vm",
+		Type: zos.ZMachineType,
+		Data: gridtypes.MustMarshal(zos.ZMachine{
+			Network: zos.MachineNetwork{
+				Interfaces: []zos.MachineInterface{{Network: "net", IP: net.ParseIP("10.1.3.5")}},
+			},
+		}),
+	}
+	deleted := vm
+	deleted.Name = "deleted"
+	deleted.Data = gridtypes.MustMarshal(zos.ZMachine{
+		Network: zos.MachineNetwork{
+			Interfaces: []zos.MachineInterface{{Network: "net", IP: net.ParseIP("10.1.3.6")}},
+		},
+	})
+	deleted.Result.State = gridtypes.StateDeleted
+
+	networks := networkStateFromDeployments(map[uint32][]gridtypes.Deployment{
+		1: {{ContractID: 10, Workloads: []gridtypes.Workload{network}}},
+		2: {{ContractID: 20, Workloads: []gridtypes.Workload{vm, deleted}}},
+	})
+	znet := networks.GetNetwork("net")
+	assert.Equal(t, map[uint32]string{1: "10.1.2.0/24"}, znet.Subnets)
+	assert.Equal(t, []byte{5}, znet.GetDeploymentHostIDs(2, 20))
+}
+
+func TestAddNetworkState(t *testing.T) {
+	cached := state.NetworkState{}
+	cachedNet := cached.GetNetwork("net")
+	cachedNet.SetNodeSubnet(1, "10.1.2.0/24")
+	cachedNet.SetNodeSubnet(3, "10.1.4.0/24")
+
+	remote := state.NetworkState{}
+	remoteNet := remote.GetNetwork("net")
+	remoteNet.SetNodeSubnet(1, "10.1.5.0/24")
+	remoteNet.SetDeploymentHostIDs(1, 10, []byte{2})
+	remote.GetNetwork("other")
+
+	addNetworkState(cached, remote)
+	znet := cached.GetNetwork("net")
+	// the grid overrides the cache, but the cached entries of unreachable nodes are kept
+	assert.Equal(t, map[uint32]string{1: "10.1.5.0/24", 3: "10.1.4.0/24"}, znet.Subnets)
+	assert.Equal(t, []byte{2}, znet.GetDeploymentHostIDs(1, 10))
+	assert.Contains(t, cached, "other")
+}
+
+func TestPruneNetworkState(t *testing.T) {
+	cached := state.NetworkState{}
+	net := cached.GetNetwork("net")
+	net.SetNodeSubnet(1, "10.1.2.0/24")
+	net.SetDeploymentHostIDs(1, 10, []byte{2})
+	net.SetNodeSubnet(2, "10.1.3.0/24")
+	net.SetDeploymentHostIDs(2, 20, []byte{2})
+	net.SetDeploymentHostIDs(2, 21, []byte{3})
+	deleted := cached.GetNetwork("deleted")
+	deleted.SetNodeSubnet(3, "10.2.2.0/24")
+
+	// node 2 is unreachable, and the contract 21 on it ended
+	pruneNetworkState(cached, map[uint32][]uint64{1: {10}, 2: {20}}, map[uint32]bool{2: true})
+	assert.NotContains(t, cached, "deleted")
+	znet := cached.GetNetwork("net")
+	assert.Equal(t, map[uint32]string{2: "10.1.3.0/24"}, znet.Subnets)
+	assert.Equal(t, state.NodeDeploymentHostIDs{2: {20: {2}}}, znet.NodeDeploymentHostIDs)
+}
+
+func TestRebuildNetworkState(t *testing.T) {
+	cached := state.NetworkState{}
+	assert.True(t, rebuildNetworkState(false, false, cached), "an empty cache is rebuilt")
+
+	net := cached.GetNetwork("net")
+	net.SetNodeSubnet(1, "10.1.2.0/24")
+	assert.False(t, rebuildNetworkState(false, false, cached))
+	assert.True(t, rebuildNetworkState(true, false, cached))
+	assert.True(t, rebuildNetworkState(false, true, cached))
+}
@@ -0,0 +1,100 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/terraform-provider-grid/internal/provider/scheduler"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+)
+
+// tftPriceUnit is the unit of the TFT price stored on tfchain, in USD
+const tftPriceUnit = 1e-3
+
+// chainClient is implemented by the substrate connection, but isn't part of subi.SubstrateExt
+type chainClient interface {
+	GetClient() (substrate.Conn, substrate.Meta, error)
+}
+
+// schedulerPricings holds a pricing per network, shared by the scheduler resources of the provider process
+var schedulerPricings = struct {
+	sync.Mutex
+	pricings map[string]*scheduler.Pricing
+}{pricings: map[string]*scheduler.Pricing{}}
+
+// schedulerPricing returns the pricing of the client's network, it's nil if the substrate connection can't be queried
+func schedulerPricing(tfPluginClient *deployer.TFPluginClient) *scheduler.Pricing {
+	sub, ok := tfPluginClient.SubstrateConn.(chainClient)
+	if !ok {
+		return nil
+	}
+	schedulerPricings.Lock()
+	defer schedulerPricings.Unlock()
+	key := tfPluginClient.Network
+	if _, ok := schedulerPricings.pricings[key]; !ok {
+		schedulerPricings.pricings[key] = scheduler.NewPricing(chainPricing{sub})
+	}
+	return schedulerPricings.pricings[key]
+}
+
+// chainPricing gets the pricing policies and the TFT price from tfchain
+type chainPricing struct {
+	client chainClient
+}
+
+// PricingPolicy gets the pricing policy with the given id
+func (c chainPricing) PricingPolicy(id uint32) (scheduler.PricingPolicy, error) {
+	var policy substrate.PricingPolicy
+	if err := c.query(&policy, "TfgridModule", "PricingPolicies", id); err != nil {
+		return scheduler.PricingPolicy{}, err
+	}
+	return scheduler.PricingPolicy{
+		CU:  uint64(policy.CU.Value),
+		SU:  uint64(policy.SU.Value),
+		IPU: uint64(policy.IPU.Value),
+	}, nil
+}
+
+// TFTPrice gets the average TFT price used by tfchain to bill contracts
+func (c chainPricing) TFTPrice() (float64, error) {
+	var price types.U32
+	if err := c.query(&price, "TFTPriceModule", "AverageTftPrice"); err != nil {
+		return 0, err
+	}
+	return float64(price) * tftPriceUnit, nil
+}
+
+// query decodes the storage entry of the given module into value, keyed by the given arguments
+func (c chainPricing) query(value interface{}, module, entry string, args ...interface{}) error {
+	cl, meta, err := c.client.GetClient()
+	if err != nil {
+		return errors.Wrap(err, "couldn't get substrate client")
+	}
+	keyArgs := [][]byte{}
+	for _, arg := range args {
+		encoded, err := substrate.Encode(arg)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't encode %s.%s key", module, entry)
+		}
+		keyArgs = append(keyArgs, encoded)
+	}
+	key, err := types.CreateStorageKey(meta, module, entry, keyArgs...)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create %s.%s key", module, entry)
+	}
+	raw, err := cl.RPC.State.GetStorageRawLatest(key)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get %s.%s", module, entry)
+	}
+	if len(*raw) == 0 {
+		return fmt.Errorf("%s.%s %v not found", module, entry, args)
+	}
+	if err := substrate.Decode(*raw, value); err != nil {
+		return errors.Wrapf(err, "couldn't decode %s.%s", module, entry)
+	}
+	return nil
+}
@@ -15,7 +15,7 @@ import (
 const errTerraformOutSync = "Error reading data from remote, terraform state might be out of sync with the remote state"
 
 // New returns a new schema.Provider instance, and an open substrate connection
-func New(version string, st state.Getter) (func() *schema.Provider, subi.SubstrateExt) {
+func New(version string, st state.Loader) (func() *schema.Provider, subi.SubstrateExt) {
 	var substrateConnection subi.SubstrateExt
 	return func() *schema.Provider {
 		p := &schema.Provider{
@@ -56,17 +56,36 @@ func New(version string, st state.Getter) (func() *schema.Provider, subi.Substra
 					Description: "timeout duration in seconds for rmb calls",
 					DefaultFunc: schema.EnvDefaultFunc("RMB_TIMEOUT", 10),
 				},
+				"state_path": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "path of the local state file caching the networks used by the deployments, defaults to a file in the terraform data directory keyed by the workspace and configuration directory",
+					DefaultFunc: schema.EnvDefaultFunc("STATE_PATH", nil),
+				},
+				"state_backend": stateBackendSchema(),
+				"rebuild_network_state": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					Description: "rebuild the cached networks from the twin's deployments on the grid, removing the entries of the deleted ones. They're always rebuilt if the stored state is empty or couldn't be read",
+					DefaultFunc: schema.EnvDefaultFunc("REBUILD_NETWORK_STATE", false),
+				},
 			},
 			DataSourcesMap: map[string]*schema.Resource{
 				"grid_gateway_domain": dataSourceGatewayDomain(),
+				"grid_nodes":          dataSourceNodes(),
+				"grid_farms":          dataSourceFarms(),
+				"grid_contracts":      dataSourceContracts(),
+				"grid_twin":           dataSourceTwin(),
+				"grid_balance":        dataSourceBalance(),
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"grid_scheduler":  resourceScheduler(),
-				"grid_deployment": resourceDeployment(),
-				"grid_network":    resourceNetwork(),
-				"grid_kubernetes": resourceKubernetes(),
-				"grid_name_proxy": resourceGatewayNameProxy(),
-				"grid_fqdn_proxy": resourceGatewayFQDNProxy(),
+				"grid_scheduler":     resourceScheduler(),
+				"grid_deployment":    resourceDeployment(),
+				"grid_network":       resourceNetwork(),
+				"grid_kubernetes":    resourceKubernetes(),
+				"grid_name_proxy":    resourceGatewayNameProxy(),
+				"grid_fqdn_proxy":    resourceGatewayFQDNProxy(),
+				"grid_rent_contract": resourceRentContract(),
 			},
 		}
 		configFunc, sub := providerConfigure(st)
@@ -77,7 +96,7 @@ func New(version string, st state.Getter) (func() *schema.Provider, subi.Substra
 	}, substrateConnection
 }
 
-func providerConfigure(st state.Getter) (func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics), subi.SubstrateExt) {
+func providerConfigure(st state.Loader) (func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics), subi.SubstrateExt) {
 	var substrateConn subi.SubstrateExt
 	return func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
 		mnemonics := d.Get("mnemonics").(string)
@@ -93,9 +112,36 @@ func providerConfigure(st state.Getter) (func(ctx context.Context, d *schema.Res
 			return nil, diag.FromErr(errors.Wrap(err, "error creating threefold plugin client"))
 		}
 
-		// set state
+		backend, err := stateBackend(d)
+		if err != nil {
+			return nil, diag.FromErr(errors.Wrap(err, "error creating state backend"))
+		}
+		var diags diag.Diagnostics
+		var recovery *state.RecoveryError
+		if err := st.Open(ctx, backend); errors.As(err, &recovery) {
+			// the networks are rebuilt from the grid below
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "couldn't read the stored state, it's rebuilt from the grid",
+				Detail:   recovery.Error(),
+			})
+		} else if err != nil {
+			return nil, diag.FromErr(errors.Wrap(err, "error loading state"))
+		}
+
+		// set state, the local state only caches the networks used by the deployments on the grid
 		tfPluginClient.State.Networks = st.GetState().Networks
+		if !rebuildNetworkState(d.Get("rebuild_network_state").(bool), recovery != nil, tfPluginClient.State.Networks) {
+			return &tfPluginClient, diags
+		}
+		if err := syncNetworkState(ctx, &tfPluginClient, tfPluginClient.State.Networks); err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "couldn't read all networks from the grid, the local state is used for the missing ones",
+				Detail:   err.Error(),
+			})
+		}
 
-		return &tfPluginClient, nil
+		return &tfPluginClient, diags
 	}, substrateConn
 }
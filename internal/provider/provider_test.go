@@ -2,8 +2,11 @@
 package provider
 
 import (
+	"path/filepath"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
 	"github.com/threefoldtech/terraform-provider-grid/internal/state"
 )
 
@@ -17,3 +20,36 @@ func TestProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 }
+
+func TestStateBackend(t *testing.T) {
+	stateDB := state.NewLocalFileState()
+	f, _ := New("dev", &stateDB)
+	providerSchema := f().Schema
+
+	d := schema.TestResourceDataRaw(t, providerSchema, map[string]interface{}{
+		"state_path": "grid.json",
+	})
+	backend, err := stateBackend(d)
+	assert.NoError(t, err)
+	assert.Equal(t, "grid.json", backend.(*state.LocalBackend).Path())
+
+	d = schema.TestResourceDataRaw(t, providerSchema, map[string]interface{}{
+		"state_backend": []interface{}{map[string]interface{}{"type": "http"}},
+	})
+	_, err = stateBackend(d)
+	assert.Error(t, err)
+
+	d = schema.TestResourceDataRaw(t, providerSchema, map[string]interface{}{
+		"state_backend": []interface{}{map[string]interface{}{"type": "s3", "bucket": "states"}},
+	})
+	backend, err = stateBackend(d)
+	assert.NoError(t, err)
+	assert.IsType(t, &state.S3Backend{}, backend)
+	// the default key is distinct per workspace and configuration like the local state file
+	key, err := state.DefaultKey()
+	assert.NoError(t, err)
+	assert.Equal(t, "terraform-provider-grid/"+key, backend.(*state.S3Backend).Key())
+	path, err := state.DefaultPath()
+	assert.NoError(t, err)
+	assert.Equal(t, key, filepath.Base(path))
+}
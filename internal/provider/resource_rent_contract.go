@@ -0,0 +1,264 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/terraform-provider-grid/internal/provider/scheduler"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// rentContractCreator is implemented by the substrate connection, but isn't part of subi.SubstrateExt
+type rentContractCreator interface {
+	CreateRentContract(identity substrate.Identity, node uint32, solutionProviderID *uint64) (uint64, error)
+}
+
+func resourceRentContract() *schema.Resource {
+	return &schema.Resource{
+		Description:   "Resource for renting a dedicated node. A user could specify the node to rent, or let the scheduler pick a rentable dedicated node satisfying the given farm and capacity.",
+		CreateContext: resourceRentContractCreate,
+		ReadContext:   resourceRentContractRead,
+		DeleteContext: resourceRentContractDelete,
+
+		Schema: map[string]*schema.Schema{
+			"node": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Computed:    true,
+				ForceNew:    true,
+				Description: "Id of the node to rent. If not set, a rentable dedicated node is picked by the scheduler.",
+			},
+			"farm_id": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Farm id to search for a rentable node in, if `node` isn't set.",
+			},
+			"cru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Number of required virtual CPUs of the node to pick, if `node` isn't set.",
+			},
+			"mru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Required memory size in MBs of the node to pick, if `node` isn't set.",
+			},
+			"sru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Required SSD size in MBs of the node to pick, if `node` isn't set.",
+			},
+			"hru": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Required HDD size in MBs of the node to pick, if `node` isn't set.",
+			},
+			"solution_provider": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "Solution provider id of the rent contract.",
+			},
+			"contract_id": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The id of the created rent contract.",
+			},
+			"total_billed": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "Total amount billed for the rent contract in units of 1e-7 TFT, as reported by the grid proxy.",
+			},
+			"billing": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Billing reports of the rent contract, as reported by the grid proxy.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"amount_billed": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Amount billed in units of 1e-7 TFT.",
+						},
+						"discount_received": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Discount level received on the billed amount.",
+						},
+						"timestamp": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "Unix timestamp of the billing.",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// pickRentableNode uses the scheduler to find a rentable dedicated node satisfying the resource's farm and capacity
+func pickRentableNode(ctx context.Context, d *schema.ResourceData, tfPluginClient *deployer.TFPluginClient) (uint32, error) {
+	sched := scheduler.NewScheduler(tfPluginClient.GridProxyClient, uint64(tfPluginClient.TwinID), tfPluginClient.RMB)
+	sched.SetCache(schedulerCache(tfPluginClient))
+	return sched.Schedule(ctx, &scheduler.Request{
+		Name:      "rent_contract",
+		FarmId:    uint32(d.Get("farm_id").(int)),
+		Dedicated: true,
+		Capacity: scheduler.Capacity{
+			CRU: uint64(d.Get("cru").(int)),
+			MRU: uint64(d.Get("mru").(int)) * uint64(gridtypes.Megabyte),
+			SRU: uint64(d.Get("sru").(int)) * uint64(gridtypes.Megabyte),
+			HRU: uint64(d.Get("hru").(int)) * uint64(gridtypes.Megabyte),
+		},
+	})
+}
+
+func resourceRentContractCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+	sub, ok := tfPluginClient.SubstrateConn.(rentContractCreator)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("substrate connection doesn't support rent contracts"))
+	}
+
+	node := uint32(d.Get("node").(int))
+	if node == 0 {
+		var err error
+		node, err = pickRentableNode(ctx, d, tfPluginClient)
+		if err != nil {
+			return diag.FromErr(errors.Wrap(err, "couldn't find a rentable node"))
+		}
+	}
+
+	var solutionProvider *uint64
+	if id := uint64(d.Get("solution_provider").(int)); id != 0 {
+		solutionProvider = &id
+	}
+	contractID, err := sub.CreateRentContract(tfPluginClient.Identity, node, solutionProvider)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't create a rent contract for node %d", node))
+	}
+
+	d.SetId(strconv.FormatUint(contractID, 10))
+	if err := d.Set("node", int(node)); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("contract_id", int(contractID)); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceRentContractRead(ctx, d, meta)
+}
+
+func resourceRentContractRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	contractID, err := strconv.ParseUint(d.Id(), 10, 64)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't parse rent contract id %s", d.Id()))
+	}
+	valid, err := tfPluginClient.SubstrateConn.IsValidContract(contractID)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't check rent contract %d", contractID))
+	}
+	if !valid {
+		// the contract was canceled outside terraform
+		d.SetId("")
+		return diags
+	}
+	contract, err := tfPluginClient.SubstrateConn.GetContract(contractID)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't get rent contract %d", contractID))
+	}
+	if !contract.ContractType.IsRentContract {
+		return diag.Errorf("contract %d isn't a rent contract", contractID)
+	}
+	if err := d.Set("node", int(contract.ContractType.RentContract.Node)); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("contract_id", int(contractID)); err != nil {
+		return diag.FromErr(err)
+	}
+
+	billing, err := rentContractBilling(tfPluginClient, contractID)
+	if err != nil {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  "couldn't read the rent contract billing",
+			Detail:   err.Error(),
+		})
+		return diags
+	}
+	total := 0
+	for _, b := range billing {
+		total += b["amount_billed"].(int)
+	}
+	if err := d.Set("billing", billing); err != nil {
+		return diag.FromErr(err)
+	}
+	if err := d.Set("total_billed", total); err != nil {
+		return diag.FromErr(err)
+	}
+	return diags
+}
+
+// rentContractBilling lists the billing reports of the contract from the grid proxy
+func rentContractBilling(tfPluginClient *deployer.TFPluginClient, contractID uint64) ([]map[string]interface{}, error) {
+	contracts, _, err := tfPluginClient.GridProxyClient.Contracts(proxyTypes.ContractFilter{
+		ContractID: &contractID,
+	}, proxyTypes.Limit{
+		Size: 1,
+		Page: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	billing := []map[string]interface{}{}
+	if len(contracts) == 0 {
+		return billing, nil
+	}
+	for _, b := range contracts[0].Billing {
+		billing = append(billing, map[string]interface{}{
+			"amount_billed":     int(b.AmountBilled),
+			"discount_received": b.DiscountReceived,
+			"timestamp":         int(b.Timestamp),
+		})
+	}
+	return billing, nil
+}
+
+func resourceRentContractDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into threefold plugin client"))
+	}
+
+	contractID, err := strconv.ParseUint(d.Id(), 10, 64)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't parse rent contract id %s", d.Id()))
+	}
+	if err := tfPluginClient.SubstrateConn.EnsureContractCanceled(tfPluginClient.Identity, contractID); err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't cancel rent contract %d", contractID))
+	}
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/centrifuge/go-substrate-rpc-client/v4/types"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	substrate "github.com/threefoldtech/tfchain/clients/tfchain-client-go"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/subi"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// rentSubstrate holds the contracts of a chain, and the nodes already rented on it
+type rentSubstrate struct {
+	subi.SubstrateExt
+	contracts map[uint64]*substrate.Contract
+	rented    map[uint32]bool
+	nextID    uint64
+}
+
+func (s *rentSubstrate) CreateRentContract(identity substrate.Identity, node uint32, solutionProviderID *uint64) (uint64, error) {
+	if s.rented[node] {
+		return 0, errors.New("NodeHasRentContract")
+	}
+	s.nextID++
+	s.contracts[s.nextID] = &substrate.Contract{
+		ContractType: substrate.ContractType{IsRentContract: true, RentContract: substrate.RentContract{Node: types.U32(node)}},
+	}
+	s.rented[node] = true
+	return s.nextID, nil
+}
+
+func (s *rentSubstrate) IsValidContract(contractID uint64) (bool, error) {
+	_, ok := s.contracts[contractID]
+	return ok, nil
+}
+
+func (s *rentSubstrate) GetContract(contractID uint64) (subi.Contract, error) {
+	contract, ok := s.contracts[contractID]
+	if !ok {
+		return subi.Contract{}, errors.New("contract not found")
+	}
+	return subi.Contract{Contract: contract}, nil
+}
+
+// billingProxy reports the billing of all contracts
+type billingProxy struct {
+	proxy.Client
+	billing []proxyTypes.ContractBilling
+}
+
+func (p *billingProxy) Contracts(filter proxyTypes.ContractFilter, limit proxyTypes.Limit) ([]proxyTypes.Contract, int, error) {
+	return []proxyTypes.Contract{{ContractID: uint(*filter.ContractID), Billing: p.billing}}, 1, nil
+}
+
+func rentClient() (*deployer.TFPluginClient, *rentSubstrate) {
+	sub := &rentSubstrate{contracts: map[uint64]*substrate.Contract{}, rented: map[uint32]bool{}}
+	return &deployer.TFPluginClient{
+		SubstrateConn: sub,
+		GridProxyClient: &billingProxy{billing: []proxyTypes.ContractBilling{
+			{AmountBilled: 10, Timestamp: 1},
+			{AmountBilled: 5, Timestamp: 2},
+		}},
+	}, sub
+}
+
+func TestRentContractSchema(t *testing.T) {
+	rentSchema := resourceRentContract().Schema
+	assert.NoError(t, schema.InternalMap(rentSchema).InternalValidate(nil))
+	for _, attr := range []string{"node", "farm_id", "cru", "mru", "sru", "hru", "solution_provider"} {
+		assert.True(t, rentSchema[attr].ForceNew, "changing %s rents another node", attr)
+	}
+	assert.True(t, rentSchema["node"].Computed, "the picked node is set")
+}
+
+func TestRentContractCreate(t *testing.T) {
+	client, sub := rentClient()
+	d := schema.TestResourceDataRaw(t, resourceRentContract().Schema, map[string]interface{}{"node": 5})
+	diags := resourceRentContractCreate(context.Background(), d, client)
+	assert.False(t, diags.HasError())
+	assert.Equal(t, "1", d.Id())
+	assert.Equal(t, 1, d.Get("contract_id"))
+	assert.Equal(t, 5, d.Get("node"))
+	assert.Equal(t, 15, d.Get("total_billed"))
+	assert.Len(t, d.Get("billing"), 2)
+
+	// the node is already rented
+	d = schema.TestResourceDataRaw(t, resourceRentContract().Schema, map[string]interface{}{"node": 5})
+	diags = resourceRentContractCreate(context.Background(), d, client)
+	assert.True(t, diags.HasError())
+	assert.Contains(t, diags[0].Summary, "node 5")
+	assert.Empty(t, d.Id())
+	assert.Len(t, sub.contracts, 1)
+}
+
+func TestRentContractCreateUnsupported(t *testing.T) {
+	client := &deployer.TFPluginClient{}
+	d := schema.TestResourceDataRaw(t, resourceRentContract().Schema, map[string]interface{}{"node": 5})
+	diags := resourceRentContractCreate(context.Background(), d, client)
+	assert.True(t, diags.HasError())
+	assert.Empty(t, d.Id())
+}
+
+func TestRentContractRead(t *testing.T) {
+	client, sub := rentClient()
+	sub.contracts[1] = &substrate.Contract{
+		ContractType: substrate.ContractType{IsRentContract: true, RentContract: substrate.RentContract{Node: 7}},
+	}
+	sub.contracts[2] = &substrate.Contract{
+		ContractType: substrate.ContractType{IsNodeContract: true},
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceRentContract().Schema, map[string]interface{}{})
+	d.SetId("1")
+	diags := resourceRentContractRead(context.Background(), d, client)
+	assert.False(t, diags.HasError())
+	assert.Equal(t, 7, d.Get("node"))
+
+	// the contract disappeared, e.g. canceled outside terraform, so the resource is removed from the state
+	delete(sub.contracts, 1)
+	diags = resourceRentContractRead(context.Background(), d, client)
+	assert.False(t, diags.HasError())
+	assert.Empty(t, d.Id())
+
+	d.SetId("2")
+	diags = resourceRentContractRead(context.Background(), d, client)
+	assert.True(t, diags.HasError(), "a node contract isn't a rent contract")
+
+	d.SetId("invalid")
+	diags = resourceRentContractRead(context.Background(), d, client)
+	assert.True(t, diags.HasError())
+}
@@ -4,24 +4,48 @@ package provider
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/pkg/errors"
 	"github.com/threefoldtech/terraform-provider-grid/internal/provider/scheduler"
 	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
 	"github.com/threefoldtech/zos/pkg/gridtypes"
 )
 
+// schedulerCacheTTL is how long the nodes listed by the scheduler resources are reused
+const schedulerCacheTTL = time.Minute
+
+// schedulerCaches holds a scheduler cache per network and twin, shared by the scheduler resources of the provider process
+var schedulerCaches = struct {
+	sync.Mutex
+	caches map[string]*scheduler.Cache
+}{caches: map[string]*scheduler.Cache{}}
+
+func schedulerCache(tfPluginClient *deployer.TFPluginClient) *scheduler.Cache {
+	schedulerCaches.Lock()
+	defer schedulerCaches.Unlock()
+	key := fmt.Sprintf("%s/%d", tfPluginClient.Network, tfPluginClient.TwinID)
+	if _, ok := schedulerCaches.caches[key]; !ok {
+		schedulerCaches.caches[key] = scheduler.NewCache(schedulerCacheTTL)
+	}
+	return schedulerCaches.caches[key]
+}
+
 func resourceScheduler() *schema.Resource {
 	return &schema.Resource{
-		Description:   "Resource to dynamically assign resource requests to nodes. A user could specify their desired node configurations, and the scheduler searches the grid for eligible nodes.",
+		Description:   "Resource to dynamically assign resource requests to nodes. A user could specify their desired node configurations, and the scheduler searches the grid for eligible nodes. Scheduler resources of the same provider share the nodes they list and the capacity they reserve, so they never assign the same free capacity twice.",
 		CreateContext: ResourceSchedCreate,
 		UpdateContext: ResourceSchedUpdate,
 		ReadContext:   ResourceSchedRead,
 		DeleteContext: ResourceSchedDelete,
+		CustomizeDiff: resourceSchedCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"requests": {
 				Type:        schema.TypeList,
@@ -69,6 +93,31 @@ func resourceScheduler() *schema.Resource {
 							Optional:    true,
 							Description: "Required count of public ips.",
 						},
+						"ipv4": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Flag to pick only nodes with a public ipv4 in their public config.",
+						},
+						"ipv6": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Flag to pick only nodes with a public ipv6 in their public config, as required by vms with `publicip6`.",
+						},
+						"has_gateway_domain": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Flag to pick only nodes with a domain in their public config, as required by name gateways.",
+						},
+						"rented_by_me": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Flag to pick only nodes rented by the user's twin.",
+						},
+						"prefer_rented": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Description: "Flag to prefer nodes rented by the user's twin over the strategy's order, so that workloads land on capacity already paid for.",
+						},
 						"certified": {
 							Type:        schema.TypeBool,
 							Optional:    true,
@@ -93,45 +142,180 @@ func resourceScheduler() *schema.Resource {
 							Default:     false,
 							Description: "True to ensure this request returns a distinct node relative to this scheduler resource.",
 						},
+						"countries": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Description: "List of country names to search for eligible nodes in.",
+						},
+						"cities": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Description: "List of city names to search for eligible nodes in.",
+						},
+						"regions": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringInSlice(scheduler.Regions(), true),
+							},
+							Description: "List of regions to search for eligible nodes in, one of: africa, asia, europe, north_america, south_america, oceania.",
+						},
+						"exclude_countries": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Description: "List of country names to exclude from the search.",
+						},
+						"exclude_cities": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Description: "List of city names to exclude from the search.",
+						},
+						"exclude_regions": {
+							Type:     schema.TypeList,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringInSlice(scheduler.Regions(), true),
+							},
+							Description: "List of regions to exclude from the search.",
+						},
+						"strategy": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      scheduler.StrategyRandom,
+							ValidateFunc: validation.StringInSlice(scheduler.Strategies, false),
+							Description:  "Strategy used to pick a node among the eligible ones, one of: random, binpack (most used node first), spread (least used node first), seeded-random (reproducible random node), cheapest (lowest estimated cost first).",
+						},
+						"seed": {
+							Type:        schema.TypeInt,
+							Optional:    true,
+							Description: "Seed of the seeded-random strategy, defaults to a hash of the request name.",
+						},
+						"spread_group": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the spread group of this request, requests sharing a spread group are assigned to different topology domains according to `spread_by`.",
+						},
+						"spread_by": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      scheduler.SpreadByNode,
+							ValidateFunc: validation.StringInSlice(scheduler.SpreadBy, false),
+							Description:  "Topology domain the spread group requests are spread on, one of: node, farm, country.",
+						},
+						"affinity_group": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the affinity group of this request, requests sharing an affinity group are assigned to the same node.",
+						},
+						"max_monthly_cost": {
+							Type:        schema.TypeFloat,
+							Optional:    true,
+							Description: "Maximum estimated monthly cost in USD of the request on its node, estimated using the farm's pricing policy, the node certification, and the dedicated node discount.",
+						},
 					},
 				},
 			},
+			"reschedule_on_failure": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "True to drop assignments of nodes that went down, aren't available anymore, or lack the required capacity while refreshing, so that the next apply assigns new nodes to their requests.",
+			},
+			"farmerbot_timeout": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     int(scheduler.DefaultFarmerBotOptions.Timeout),
+				Description: "Timeout in seconds of the farmerbot jobs finding nodes for requests with a farm id.",
+			},
+			"farmerbot_retries": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     int(scheduler.DefaultFarmerBotOptions.Retries),
+				Description: "Number of times a failed farmerbot call is retried before falling back to searching the grid proxy.",
+			},
+			"farmerbot_wake_up_timeout": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     int(scheduler.DefaultFarmerBotOptions.WakeUpTimeout.Seconds()),
+				Description: "Total time in seconds to wait for the nodes picked by the farmerbots to be up and reachable, as they may be powered on first. It's shared by all the requests, and once it's spent, the grid proxy is searched instead of waiting for nodes. Zero disables waiting.",
+			},
+			"explain": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "True to record how many candidate nodes were examined for each request, and which requirement rejected them. Explanations are reported in `explanations` and in scheduling errors.",
+			},
 			"nodes": {
 				Type:        schema.TypeMap,
 				Computed:    true,
 				Elem:        &schema.Schema{Type: schema.TypeInt},
 				Description: "Mapping from the request name to the node id.",
 			},
+			"costs": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeFloat},
+				Description: "Mapping from the request name to the estimated monthly cost in USD of the request on its node.",
+			},
+			"tft_costs": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeFloat},
+				Description: "Mapping from the request name to the estimated monthly cost in TFT of the request on its node, using the average TFT price on tfchain.",
+			},
+			"explanations": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Mapping from the request name to an explanation of how its node was picked, only set if `explain` is true.",
+			},
 		},
 	}
 }
 
 func parseAssignment(d *schema.ResourceData) map[string]uint32 {
-	assignmentIfs := d.Get("nodes").(map[string]interface{})
+	// nodes could be marked as unknown to reschedule some requests, so the previous assignment is used
+	assignmentIfs, _ := d.GetChange("nodes")
 	assignment := make(map[string]uint32)
-	for k, v := range assignmentIfs {
+	for k, v := range assignmentIfs.(map[string]interface{}) {
 		assignment[k] = uint32(v.(int))
 	}
 	return assignment
 }
 
-func parseRequests(d *schema.ResourceData, assignment map[string]uint32) []scheduler.Request {
+func parseRequests(d *schema.ResourceData) ([]scheduler.Request, error) {
 	reqsIfs := d.Get("requests").([]interface{})
 	reqs := make([]scheduler.Request, 0)
 	for _, r := range reqsIfs {
 		mp := r.(map[string]interface{})
-		if _, ok := assignment[mp["name"].(string)]; ok {
-			// skip already assigned ones
-			continue
-		}
+		name := mp["name"].(string)
 		nodesToExcludeIF := mp["node_exclude"].([]interface{})
 		nodesToExclude := make([]uint32, len(nodesToExcludeIF))
 		for idx, n := range nodesToExcludeIF {
 			nodesToExclude[idx] = uint32(n.(int))
 		}
 
+		strategy, err := scheduler.NewStrategy(mp["strategy"].(string), int64(mp["seed"].(int)), name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid strategy of request %s", name)
+		}
+
 		reqs = append(reqs, scheduler.Request{
-			Name:           mp["name"].(string),
+			Name:           name,
 			FarmId:         uint32(mp["farm_id"].(int)),
 			PublicConfig:   mp["public_config"].(bool),
 			PublicIpsCount: uint32(mp["public_ips_count"].(int)),
@@ -139,14 +323,41 @@ func parseRequests(d *schema.ResourceData, assignment map[string]uint32) []sched
 			Dedicated:      mp["dedicated"].(bool),
 			NodeExclude:    nodesToExclude,
 			Capacity: scheduler.Capacity{
+				CRU: uint64(mp["cru"].(int)),
 				MRU: uint64(mp["mru"].(int)) * uint64(gridtypes.Megabyte),
 				HRU: uint64(mp["hru"].(int)) * uint64(gridtypes.Megabyte),
 				SRU: uint64(mp["sru"].(int)) * uint64(gridtypes.Megabyte),
 			},
-			Distinct: mp["distinct"].(bool),
+			Distinct:         mp["distinct"].(bool),
+			IPv4:             mp["ipv4"].(bool),
+			IPv6:             mp["ipv6"].(bool),
+			HasGatewayDomain: mp["has_gateway_domain"].(bool),
+			RentedByMe:       mp["rented_by_me"].(bool),
+			PreferRented:     mp["prefer_rented"].(bool),
+			Location: scheduler.Location{
+				Countries:        parseStringList(mp["countries"]),
+				Cities:           parseStringList(mp["cities"]),
+				Regions:          parseStringList(mp["regions"]),
+				ExcludeCountries: parseStringList(mp["exclude_countries"]),
+				ExcludeCities:    parseStringList(mp["exclude_cities"]),
+				ExcludeRegions:   parseStringList(mp["exclude_regions"]),
+			},
+			Strategy:       strategy,
+			SpreadGroup:    mp["spread_group"].(string),
+			SpreadBy:       mp["spread_by"].(string),
+			AffinityGroup:  mp["affinity_group"].(string),
+			MaxMonthlyCost: mp["max_monthly_cost"].(float64),
 		})
 	}
-	return reqs
+	return reqs, nil
+}
+
+func parseStringList(listIf interface{}) []string {
+	list := make([]string, 0)
+	for _, v := range listIf.([]interface{}) {
+		list = append(list, v.(string))
+	}
+	return list
 }
 
 func schedule(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -156,24 +367,192 @@ func schedule(ctx context.Context, d *schema.ResourceData, meta interface{}) dia
 	}
 	// read previously assigned nodes
 	assignment := parseAssignment(d)
-	reqs := parseRequests(d, assignment)
+	reqs, err := parseRequests(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	scheduler := scheduler.NewScheduler(tfPluginClient.GridProxyClient, uint64(tfPluginClient.TwinID), tfPluginClient.RMB)
-	if err := scheduler.ProcessRequests(ctx, reqs, assignment); err != nil {
+	sched := scheduler.NewScheduler(tfPluginClient.GridProxyClient, uint64(tfPluginClient.TwinID), tfPluginClient.RMB)
+	sched.SetCache(schedulerCache(tfPluginClient))
+	if pricing := schedulerPricing(tfPluginClient); pricing != nil {
+		sched.SetPricing(pricing)
+	}
+	sched.SetFarmerBotOptions(scheduler.FarmerBotOptions{
+		Timeout:        uint32(d.Get("farmerbot_timeout").(int)),
+		Retries:        uint32(d.Get("farmerbot_retries").(int)),
+		RetryInterval:  scheduler.DefaultFarmerBotOptions.RetryInterval,
+		WakeUpTimeout:  time.Duration(d.Get("farmerbot_wake_up_timeout").(int)) * time.Second,
+		WakeUpInterval: scheduler.DefaultFarmerBotOptions.WakeUpInterval,
+	})
+	err = sched.ProcessRequests(ctx, reqs, assignment)
+	explanations := explainRequests(d, sched.Explanations())
+	if err != nil && d.Get("explain").(bool) {
+		return diag.Diagnostics{
+			diag.Diagnostic{
+				Severity: diag.Error,
+				Summary:  err.Error(),
+				Detail:   formatExplanations(explanations),
+			},
+		}
+	}
+	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	err := d.Set("nodes", assignment)
+	err = d.Set("nodes", assignment)
 	if err != nil {
 		return diag.FromErr(errors.Wrapf(err, "couldn't set nodes with %v", assignment))
 	}
+	costs := requestsCosts(d, "costs", sched.Costs())
+	err = d.Set("costs", costs)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't set costs with %v", costs))
+	}
+	tftCosts := requestsCosts(d, "tft_costs", sched.TFTCosts())
+	err = d.Set("tft_costs", tftCosts)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't set tft costs with %v", tftCosts))
+	}
+	err = d.Set("explanations", explanations)
+	if err != nil {
+		return diag.FromErr(errors.Wrapf(err, "couldn't set explanations with %v", explanations))
+	}
 	return nil
 
 }
 
+// explainRequests returns the explanation of each request if explain mode is enabled,
+// requests that weren't scheduled keep their previous explanations
+func explainRequests(d *schema.ResourceData, processed map[string]*scheduler.Explanation) map[string]string {
+	explanations := make(map[string]string)
+	if !d.Get("explain").(bool) {
+		return explanations
+	}
+	previous := d.Get("explanations").(map[string]interface{})
+	for _, r := range d.Get("requests").([]interface{}) {
+		name := r.(map[string]interface{})["name"].(string)
+		if e, ok := processed[name]; ok {
+			explanations[name] = e.String()
+		} else if e, ok := previous[name]; ok {
+			explanations[name] = e.(string)
+		}
+	}
+	return explanations
+}
+
+// requestsCosts returns the estimated cost of each request,
+// requests that weren't scheduled keep their previous costs
+func requestsCosts(d *schema.ResourceData, key string, processed map[string]float64) map[string]float64 {
+	costs := make(map[string]float64)
+	previous := d.Get(key).(map[string]interface{})
+	for _, r := range d.Get("requests").([]interface{}) {
+		name := r.(map[string]interface{})["name"].(string)
+		if cost, ok := processed[name]; ok {
+			costs[name] = cost
+		} else if cost, ok := previous[name]; ok {
+			costs[name] = cost.(float64)
+		}
+	}
+	return costs
+}
+
+func formatExplanations(explanations map[string]string) string {
+	names := make([]string, 0, len(explanations))
+	for name := range explanations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, explanations[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // ResourceSchedRead reads for schedule resource
 func ResourceSchedRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	return diag.Diagnostics{}
+	tfPluginClient, ok := meta.(*deployer.TFPluginClient)
+	if !ok {
+		return diag.FromErr(fmt.Errorf("failed to cast meta into api client"))
+	}
+	assignment := parseAssignment(d)
+	reqs, err := parseRequests(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	reschedule := d.Get("reschedule_on_failure").(bool)
+
+	var diags diag.Diagnostics
+	sched := scheduler.NewScheduler(tfPluginClient.GridProxyClient, uint64(tfPluginClient.TwinID), tfPluginClient.RMB)
+	for _, r := range reqs {
+		node, ok := assignment[r.Name]
+		if !ok {
+			continue
+		}
+		err := sched.Verify(node, &r)
+		if err == nil {
+			continue
+		}
+		var ineligible *scheduler.IneligibleError
+		if !errors.As(err, &ineligible) {
+			// the node couldn't be checked, so its assignment is kept rather than rescheduled
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  fmt.Sprintf("couldn't verify node %d assigned to request %s, the assignment is kept", node, r.Name),
+				Detail:   err.Error(),
+			})
+			continue
+		}
+		summary := fmt.Sprintf("node %d assigned to request %s is not eligible anymore", node, r.Name)
+		if reschedule {
+			delete(assignment, r.Name)
+			summary = fmt.Sprintf("node %d assigned to request %s is not eligible anymore, the request will be rescheduled", node, r.Name)
+		}
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  summary,
+			Detail:   err.Error(),
+		})
+	}
+
+	if reschedule {
+		if err := d.Set("nodes", assignment); err != nil {
+			return append(diags, diag.FromErr(errors.Wrapf(err, "couldn't set nodes with %v", assignment))...)
+		}
+	}
+	return diags
+}
+
+// resourceSchedCustomizeDiff marks the nodes as unknown if a request's assignment was dropped while refreshing,
+// so that an update is planned to reschedule it
+func resourceSchedCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if droppedAssignment(d) {
+		return d.SetNewComputed("nodes")
+	}
+	return nil
+}
+
+// resourceGetter is implemented by both the resource data and diff
+type resourceGetter interface {
+	Id() string
+	Get(key string) interface{}
+}
+
+// droppedAssignment checks if a request of an existing scheduler isn't assigned a node,
+// which happens when its node was found ineligible while refreshing
+func droppedAssignment(d resourceGetter) bool {
+	if d.Id() == "" || !d.Get("reschedule_on_failure").(bool) {
+		return false
+	}
+	assignment := d.Get("nodes").(map[string]interface{})
+	for _, r := range d.Get("requests").([]interface{}) {
+		name := r.(map[string]interface{})["name"].(string)
+		if _, ok := assignment[name]; !ok {
+			return true
+		}
+	}
+	return false
 }
 
 // ResourceSchedCreate creates for schedule resource
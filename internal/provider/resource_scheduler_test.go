@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/deployer"
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestSchedulerRequestValidation(t *testing.T) {
+	requestSchema := resourceScheduler().Schema["requests"].Elem.(*schema.Resource).Schema
+	validate := func(attr string, value string) bool {
+		s := requestSchema[attr]
+		if elem, ok := s.Elem.(*schema.Schema); ok {
+			s = elem
+		}
+		_, errs := s.ValidateFunc(value, attr)
+		return len(errs) == 0
+	}
+
+	assert.True(t, validate("regions", "europe"))
+	assert.True(t, validate("regions", "North_America"))
+	assert.False(t, validate("regions", "atlantis"))
+	assert.True(t, validate("exclude_regions", "asia"))
+	assert.False(t, validate("exclude_regions", "eu"))
+	assert.True(t, validate("strategy", "binpack"))
+	assert.False(t, validate("strategy", "fastest"))
+	assert.True(t, validate("spread_by", "farm"))
+	assert.False(t, validate("spread_by", "city"))
+}
+
+// nodesProxy lists the given nodes, or fails with the given error
+type nodesProxy struct {
+	proxy.Client
+	nodes map[uint64]proxyTypes.Node
+	err   error
+}
+
+func (p *nodesProxy) Nodes(filter proxyTypes.NodeFilter, limit proxyTypes.Limit) ([]proxyTypes.Node, int, error) {
+	if p.err != nil {
+		return nil, 0, p.err
+	}
+	node, ok := p.nodes[*filter.NodeID]
+	if !ok {
+		return nil, 0, nil
+	}
+	return []proxyTypes.Node{node}, 1, nil
+}
+
+// schedulerData returns the data of an existing scheduler with the given assignment
+func schedulerData(t *testing.T, nodes map[string]interface{}) *schema.ResourceData {
+	raw := schema.TestResourceDataRaw(t, resourceScheduler().Schema, map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"name": "vm", "mru": 1024},
+			map[string]interface{}{"name": "zdb", "hru": 1024},
+		},
+		"reschedule_on_failure": true,
+	})
+	raw.SetId("1")
+	assert.NoError(t, raw.Set("nodes", nodes))
+	return resourceScheduler().Data(raw.State())
+}
+
+func TestResourceSchedRead(t *testing.T) {
+	capacity := proxyTypes.Capacity{MRU: 4 * gridtypes.Gigabyte, HRU: 4 * gridtypes.Gigabyte}
+	client := &deployer.TFPluginClient{TwinID: 1}
+
+	t.Run("ineligible", func(t *testing.T) {
+		client.GridProxyClient = &nodesProxy{nodes: map[uint64]proxyTypes.Node{
+			1: {NodeID: 1, Status: "up", TotalResources: capacity},
+			2: {NodeID: 2, Status: "down", TotalResources: capacity},
+		}}
+		d := schedulerData(t, map[string]interface{}{"vm": 1, "zdb": 2})
+		diags := ResourceSchedRead(context.Background(), d, client)
+		assert.False(t, diags.HasError())
+		assert.Len(t, diags, 1)
+		assert.Equal(t, map[string]interface{}{"vm": 1}, d.Get("nodes"))
+		assert.True(t, droppedAssignment(d))
+	})
+
+	t.Run("proxy-failure", func(t *testing.T) {
+		client.GridProxyClient = &nodesProxy{err: errors.New("grid proxy is unreachable")}
+		d := schedulerData(t, map[string]interface{}{"vm": 1, "zdb": 2})
+		diags := ResourceSchedRead(context.Background(), d, client)
+		assert.False(t, diags.HasError())
+		assert.Len(t, diags, 2, "each assignment that couldn't be verified is reported")
+		assert.Equal(t, map[string]interface{}{"vm": 1, "zdb": 2}, d.Get("nodes"), "healthy assignments are kept")
+		assert.False(t, droppedAssignment(d))
+	})
+}
+
+func TestDroppedAssignment(t *testing.T) {
+	d := schedulerData(t, map[string]interface{}{"vm": 1, "zdb": 2})
+	assert.False(t, droppedAssignment(d))
+
+	d = schedulerData(t, map[string]interface{}{"vm": 1})
+	assert.True(t, droppedAssignment(d))
+
+	assert.NoError(t, d.Set("reschedule_on_failure", false))
+	assert.False(t, droppedAssignment(d), "assignments aren't dropped without reschedule_on_failure")
+
+	d = schedulerData(t, map[string]interface{}{})
+	d.SetId("")
+	assert.False(t, droppedAssignment(d), "new schedulers are scheduled on create")
+}
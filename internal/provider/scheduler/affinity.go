@@ -0,0 +1,161 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// batch is a request scheduled as a single unit, on behalf of one or more requests sharing an affinity group
+type batch struct {
+	request Request
+	members []string
+}
+
+// batchRequests merges the requests of each affinity group into a single request aggregating their capacity,
+// batches are ordered by the first appearance of their requests
+func batchRequests(reqs []Request) ([]batch, error) {
+	batches := []batch{}
+	groups := map[string]int{}
+	members := map[int][]Request{}
+	for _, r := range reqs {
+		if r.AffinityGroup == "" {
+			batches = append(batches, batch{request: r, members: []string{r.Name}})
+			continue
+		}
+		idx, ok := groups[r.AffinityGroup]
+		if !ok {
+			groups[r.AffinityGroup] = len(batches)
+			members[len(batches)] = []Request{r}
+			batches = append(batches, batch{request: r, members: []string{r.Name}})
+			continue
+		}
+		if err := batches[idx].request.merge(&r); err != nil {
+			return nil, errors.Wrapf(err, "couldn't add request %s to affinity group %s", r.Name, r.AffinityGroup)
+		}
+		batches[idx].members = append(batches[idx].members, r.Name)
+		members[idx] = append(members[idx], r)
+	}
+	for idx := range batches {
+		batches[idx].request.members = members[idx]
+		if len(batches[idx].members) > 1 {
+			batches[idx].request.Name = strings.Join(batches[idx].members, ",")
+		}
+	}
+	return batches, nil
+}
+
+// merge aggregates the other request's requirements into the request
+func (r *Request) merge(other *Request) error {
+	if r.FarmId != 0 && other.FarmId != 0 && r.FarmId != other.FarmId {
+		return fmt.Errorf("conflicting farm ids %d and %d", r.FarmId, other.FarmId)
+	}
+	if r.SpreadGroup != "" && other.SpreadGroup != "" && (r.SpreadGroup != other.SpreadGroup || r.spreadBy() != other.spreadBy()) {
+		return fmt.Errorf("conflicting spread groups %s and %s", r.SpreadGroup, other.SpreadGroup)
+	}
+
+	var err error
+	if r.Location.Countries, err = mergeAllowList(r.Location.Countries, other.Location.Countries); err != nil {
+		return errors.Wrap(err, "conflicting countries")
+	}
+	if r.Location.Cities, err = mergeAllowList(r.Location.Cities, other.Location.Cities); err != nil {
+		return errors.Wrap(err, "conflicting cities")
+	}
+	if r.Location.Regions, err = mergeAllowList(r.Location.Regions, other.Location.Regions); err != nil {
+		return errors.Wrap(err, "conflicting regions")
+	}
+	r.Location.ExcludeCountries = concat(r.Location.ExcludeCountries, other.Location.ExcludeCountries)
+	r.Location.ExcludeCities = concat(r.Location.ExcludeCities, other.Location.ExcludeCities)
+	r.Location.ExcludeRegions = concat(r.Location.ExcludeRegions, other.Location.ExcludeRegions)
+
+	r.Capacity.CRU += other.Capacity.CRU
+	r.Capacity.MRU += other.Capacity.MRU
+	r.Capacity.SRU += other.Capacity.SRU
+	r.Capacity.HRU += other.Capacity.HRU
+	r.PublicIpsCount += other.PublicIpsCount
+	if r.FarmId == 0 {
+		r.FarmId = other.FarmId
+	}
+	if r.SpreadGroup == "" {
+		r.SpreadGroup = other.SpreadGroup
+		r.SpreadBy = other.SpreadBy
+	}
+	r.PublicConfig = r.PublicConfig || other.PublicConfig
+	r.IPv4 = r.IPv4 || other.IPv4
+	r.IPv6 = r.IPv6 || other.IPv6
+	r.HasGatewayDomain = r.HasGatewayDomain || other.HasGatewayDomain
+	r.RentedByMe = r.RentedByMe || other.RentedByMe
+	r.PreferRented = r.PreferRented || other.PreferRented
+	r.Certified = r.Certified || other.Certified
+	r.Dedicated = r.Dedicated || other.Dedicated
+	r.Distinct = r.Distinct || other.Distinct
+	r.NodeExclude = concat(r.NodeExclude, other.NodeExclude)
+	return nil
+}
+
+// mergeConstraints aggregates the other request's requirements into the request, besides its capacity and public ips
+// which are already consumed, as for the members of an affinity group assigned before
+func (r *Request) mergeConstraints(other *Request) error {
+	constraints := *other
+	constraints.Capacity = Capacity{}
+	constraints.PublicIpsCount = 0
+	return r.merge(&constraints)
+}
+
+// concat returns a new slice so that merging never modifies the requests' slices
+func concat[T any](elements, others []T) []T {
+	return append(append([]T{}, elements...), others...)
+}
+
+func mergeAllowList(list, other []string) ([]string, error) {
+	if len(list) == 0 {
+		return other, nil
+	}
+	if len(other) != 0 && !reflect.DeepEqual(list, other) {
+		return nil, fmt.Errorf("%v and %v", list, other)
+	}
+	return list, nil
+}
+
+// scheduleOn makes sure the given node satisfies the request, and consumes its capacity
+func (n *Scheduler) scheduleOn(r *Request, nodeID uint32) error {
+	r.twinID = n.twinID
+	node, err := n.getNodeDetails(nodeID)
+	if err != nil {
+		return err
+	}
+	n.addNodes([]proxyTypes.Node{node})
+
+	farm, err := n.getFarmInfo(uint32(node.FarmID))
+	if err != nil {
+		return errors.Wrapf(err, "failed to get farm %d info", node.FarmID)
+	}
+	free := n.cache.freeCapacity(nodeID, *n.nodes[nodeID].FreeCapacity)
+	info := nodeInfo{FreeCapacity: &free, Node: node}
+	e := n.explain(r)
+	rejection := info.rejection(r, farm)
+	if rejection == "" && !n.reserve(r, nodeID) {
+		rejection = rejectReserved
+	}
+	e.examine(nodeID, rejection)
+	if rejection != "" {
+		return fmt.Errorf("node %d doesn't satisfy the %s requirement", nodeID, rejection)
+	}
+	e.Node = nodeID
+	return nil
+}
+
+// explainMembers shares the explanation of a batch with each of its members
+func (n *Scheduler) explainMembers(b batch) {
+	e, ok := n.explanations[b.request.Name]
+	if !ok {
+		return
+	}
+	for _, name := range b.members {
+		n.explanations[name] = e
+	}
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchRequests(t *testing.T) {
+	vmExclude := []uint32{1}
+	batches, err := batchRequests([]Request{
+		{Name: "vm", AffinityGroup: "g", Capacity: Capacity{CRU: 2, MRU: 4}, NodeExclude: vmExclude, PublicIpsCount: 1},
+		{Name: "other", Capacity: Capacity{MRU: 1}},
+		{Name: "zdb", AffinityGroup: "g", Capacity: Capacity{HRU: 10}, FarmId: 3, NodeExclude: []uint32{2}},
+		{Name: "disk", AffinityGroup: "g", Capacity: Capacity{SRU: 5}, PublicConfig: true},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, batches, 2)
+
+	assert.Equal(t, batches[0].members, []string{"vm", "zdb", "disk"})
+	merged := batches[0].request
+	assert.Equal(t, merged.Capacity, Capacity{CRU: 2, MRU: 4, HRU: 10, SRU: 5})
+	assert.Equal(t, merged.FarmId, uint32(3))
+	assert.Equal(t, merged.PublicIpsCount, uint32(1))
+	assert.True(t, merged.PublicConfig)
+	assert.Equal(t, merged.NodeExclude, []uint32{1, 2})
+	assert.Equal(t, vmExclude, []uint32{1}, "merging shouldn't modify the requests")
+
+	assert.Equal(t, batches[1].members, []string{"other"})
+	assert.Equal(t, batches[1].request.Name, "other")
+}
+
+func TestBatchRequestsConflict(t *testing.T) {
+	conflicts := map[string][]Request{
+		"farm": {
+			{Name: "a", AffinityGroup: "g", FarmId: 1},
+			{Name: "b", AffinityGroup: "g", FarmId: 2},
+		},
+		"countries": {
+			{Name: "a", AffinityGroup: "g", Location: Location{Countries: []string{"Egypt"}}},
+			{Name: "b", AffinityGroup: "g", Location: Location{Countries: []string{"Belgium"}}},
+		},
+		"spread_group": {
+			{Name: "a", AffinityGroup: "g", SpreadGroup: "s1"},
+			{Name: "b", AffinityGroup: "g", SpreadGroup: "s2"},
+		},
+	}
+	for key, reqs := range conflicts {
+		_, err := batchRequests(reqs)
+		assert.Error(t, err, key)
+	}
+}
@@ -0,0 +1,177 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// Cache can be shared by the schedulers of a provider process, so that they don't list the same nodes
+// from the grid proxy repeatedly, and see each other's reservations instead of double-booking free capacity
+type Cache struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	// pages maps a listing filter and pagination to the nodes returned by the grid proxy
+	pages map[string]cachedPage
+	// reservations are the resources reserved by the schedulers, keyed by their ids
+	reservations    map[uint64]reservation
+	nextReservation uint64
+}
+
+// reservation is the capacity reserved on a node and the public ips reserved on its farm for a request
+type reservation struct {
+	nodeID   uint32
+	farmID   uint32
+	capacity Capacity
+	ips      uint64
+	// expires is when the reservation is dropped, zero for never
+	expires time.Time
+}
+
+type cachedPage struct {
+	nodes   []proxyTypes.Node
+	expires time.Time
+}
+
+// NewCache creates a cache keeping listed nodes for the given ttl, a zero ttl disables caching them.
+// Reservations are kept for the same ttl, as the nodes listed after it report the deployed resources as used,
+// and are kept for the cache's lifetime with a zero ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:          ttl,
+		pages:        map[string]cachedPage{},
+		reservations: map[uint64]reservation{},
+	}
+}
+
+func pageKey(filter proxyTypes.NodeFilter, limit proxyTypes.Limit) (string, error) {
+	key, err := json.Marshal(struct {
+		Filter proxyTypes.NodeFilter
+		Limit  proxyTypes.Limit
+	}{filter, limit})
+	return string(key), err
+}
+
+// listNodes returns the nodes listed from the grid proxy for the given filter and pagination
+func (c *Cache) listNodes(client proxy.Client, filter proxyTypes.NodeFilter, limit proxyTypes.Limit) ([]proxyTypes.Node, error) {
+	key, err := pageKey(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	page, ok := c.pages[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(page.expires) {
+		return page.nodes, nil
+	}
+
+	nodes, _, err := client.Nodes(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl != 0 {
+		c.mu.Lock()
+		c.pages[key] = cachedPage{nodes: nodes, expires: time.Now().Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return nodes, nil
+}
+
+// freeCapacity returns the node's free capacity minus the capacity reserved on it
+func (c *Cache) freeCapacity(nodeID uint32, free Capacity) Capacity {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return free.minus(c.reservedCapacity(nodeID))
+}
+
+// freeIPs returns the farm's free public ips minus the ones reserved on it
+func (c *Cache) freeIPs(farmID uint32, free uint64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reserved := c.reservedIPs(farmID)
+	if reserved > free {
+		return 0
+	}
+	return free - reserved
+}
+
+// reserve reserves the request's capacity on the node and its public ips on the farm,
+// it fails if they don't fit anymore in the given free resources because of other reservations
+func (c *Cache) reserve(nodeID uint32, free Capacity, farmID uint32, freeIPs uint64, r *Request) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	available := free.minus(c.reservedCapacity(nodeID))
+	if !available.fits(r) || c.reservedIPs(farmID)+uint64(r.PublicIpsCount) > freeIPs {
+		return 0, false
+	}
+	return c.record(nodeID, farmID, r), true
+}
+
+// recordReservation reserves the request's resources regardless of the node's free capacity,
+// it's used for nodes picked by farmerbots
+func (c *Cache) recordReservation(nodeID uint32, farmID uint32, r *Request) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.record(nodeID, farmID, r)
+}
+
+// release drops the reservation with the given id
+func (c *Cache) release(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.reservations, id)
+}
+
+func (c *Cache) record(nodeID uint32, farmID uint32, r *Request) uint64 {
+	res := reservation{
+		nodeID:   nodeID,
+		farmID:   farmID,
+		capacity: r.Capacity,
+		ips:      uint64(r.PublicIpsCount),
+	}
+	if c.ttl != 0 {
+		res.expires = time.Now().Add(c.ttl)
+	}
+	c.nextReservation++
+	c.reservations[c.nextReservation] = res
+	return c.nextReservation
+}
+
+// activeReservations drops the expired reservations, and returns the rest
+func (c *Cache) activeReservations() map[uint64]reservation {
+	now := time.Now()
+	for id, res := range c.reservations {
+		if !res.expires.IsZero() && now.After(res.expires) {
+			delete(c.reservations, id)
+		}
+	}
+	return c.reservations
+}
+
+func (c *Cache) reservedCapacity(nodeID uint32) Capacity {
+	reserved := Capacity{}
+	for _, res := range c.activeReservations() {
+		if res.nodeID != nodeID {
+			continue
+		}
+		reserved.MRU += res.capacity.MRU
+		reserved.SRU += res.capacity.SRU
+		reserved.HRU += res.capacity.HRU
+		reserved.CRU += res.capacity.CRU
+	}
+	return reserved
+}
+
+func (c *Cache) reservedIPs(farmID uint32) uint64 {
+	reserved := uint64(0)
+	for _, res := range c.activeReservations() {
+		if res.farmID == farmID {
+			reserved += res.ips
+		}
+	}
+	return reserved
+}
@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func cacheGrid() *GridProxyClientMock {
+	proxy := &GridProxyClientMock{}
+	for id := 1; id <= 2; id++ {
+		proxy.AddNode(uint32(id), proxyTypes.Node{
+			NodeID:         id,
+			FarmID:         1,
+			TotalResources: proxyTypes.Capacity{MRU: 4 * gridtypes.Gigabyte},
+		})
+	}
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1, PublicIps: []proxyTypes.PublicIP{{IP: "1.1.1.1"}}})
+	return proxy
+}
+
+func TestCacheSharedReservations(t *testing.T) {
+	proxy := cacheGrid()
+	cache := NewCache(time.Minute)
+	r := Request{Name: "req", Capacity: Capacity{MRU: 3 * uint64(gridtypes.Gigabyte)}, Strategy: BinPackStrategy{}}
+
+	assignments := []map[string]uint32{{}, {}}
+	calls := []int{}
+	for _, assignment := range assignments {
+		scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+		scheduler.SetCache(cache)
+		assert.NoError(t, scheduler.ProcessRequests(context.Background(), []Request{r}, assignment))
+		calls = append(calls, proxy.nodesCalls)
+	}
+	assert.NotEqual(t, assignments[0]["req"], assignments[1]["req"], "both schedulers booked the same free memory")
+	assert.Equal(t, calls[0], calls[1], "the second scheduler should use the cached nodes")
+
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetCache(cache)
+	assert.Error(t, scheduler.ProcessRequests(context.Background(), []Request{r}, map[string]uint32{}), "all memory is reserved")
+}
+
+func TestCacheSharedPublicIPs(t *testing.T) {
+	proxy := cacheGrid()
+	cache := NewCache(time.Minute)
+	r := Request{Name: "req", PublicIpsCount: 1}
+
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetCache(cache)
+	assert.NoError(t, scheduler.ProcessRequests(context.Background(), []Request{r}, map[string]uint32{}))
+
+	scheduler = NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetCache(cache)
+	assert.Error(t, scheduler.ProcessRequests(context.Background(), []Request{r}, map[string]uint32{}), "the farm's only ip is reserved")
+}
+
+func TestCacheTTL(t *testing.T) {
+	proxy := cacheGrid()
+	cache := NewCache(0)
+	for i := 0; i < 2; i++ {
+		_, err := cache.listNodes(proxy, proxyTypes.NodeFilter{}, proxyTypes.Limit{Page: 1, Size: 10})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, proxy.nodesCalls, 2, "nodes shouldn't be cached with a zero ttl")
+
+	cache = NewCache(time.Millisecond)
+	_, err := cache.listNodes(proxy, proxyTypes.NodeFilter{}, proxyTypes.Limit{Page: 1, Size: 10})
+	assert.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	_, err = cache.listNodes(proxy, proxyTypes.NodeFilter{}, proxyTypes.Limit{Page: 1, Size: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, proxy.nodesCalls, 4, "expired nodes should be listed again")
+}
+
+func TestCacheConcurrentReservations(t *testing.T) {
+	cache := NewCache(time.Minute)
+	free := Capacity{MRU: 10}
+	r := Request{Capacity: Capacity{MRU: 1}}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := cache.reserve(1, free, 1, 0, &r); ok {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, reserved, 10)
+	assert.Equal(t, cache.freeCapacity(1, free), Capacity{})
+}
+
+func TestCacheReservationTTL(t *testing.T) {
+	free := Capacity{MRU: 10}
+	r := Request{Capacity: Capacity{MRU: 4}, PublicIpsCount: 1}
+
+	cache := NewCache(time.Millisecond)
+	_, ok := cache.reserve(1, free, 1, 1, &r)
+	assert.True(t, ok)
+	assert.Equal(t, Capacity{MRU: 6}, cache.freeCapacity(1, free))
+	assert.Equal(t, uint64(0), cache.freeIPs(1, 1))
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, free, cache.freeCapacity(1, free), "reservations expire with the cached nodes")
+	assert.Equal(t, uint64(1), cache.freeIPs(1, 1))
+
+	cache = NewCache(0)
+	cache.recordReservation(1, 1, &r)
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, Capacity{MRU: 6}, cache.freeCapacity(1, free), "reservations are kept without a ttl")
+}
+
+func TestCacheRelease(t *testing.T) {
+	free := Capacity{MRU: 10}
+	cache := NewCache(time.Minute)
+	first, ok := cache.reserve(1, free, 1, 0, &Request{Capacity: Capacity{MRU: 4}})
+	assert.True(t, ok)
+	_, ok = cache.reserve(1, free, 1, 0, &Request{Capacity: Capacity{MRU: 5}})
+	assert.True(t, ok)
+
+	cache.release(first)
+	assert.Equal(t, Capacity{MRU: 5}, cache.freeCapacity(1, free))
+}
+
+func TestCacheReleaseFailedRequests(t *testing.T) {
+	proxy := cacheGrid()
+	cache := NewCache(time.Minute)
+	capacity := Capacity{MRU: 3 * uint64(gridtypes.Gigabyte)}
+
+	// the farmerbot picks a node for the request regardless of its cost, which exceeds the max cost,
+	// so the node isn't reserved anymore
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{hasFarmerBot: true, nodeID: 1})
+	scheduler.SetFarmerBotOptions(FarmerBotOptions{})
+	scheduler.SetCache(cache)
+	err := scheduler.ProcessRequests(context.Background(), []Request{
+		{Name: "expensive", Capacity: capacity, MaxMonthlyCost: 1e-9, FarmId: 1},
+	}, map[string]uint32{})
+	assert.Error(t, err)
+	for _, node := range []uint32{1, 2} {
+		assert.Equal(t, uint64(4*gridtypes.Gigabyte), cache.freeCapacity(node, Capacity{MRU: 4 * uint64(gridtypes.Gigabyte)}).MRU)
+	}
+}
@@ -5,7 +5,7 @@ import (
 	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
 )
 
-// Capacity struct for capacity (MRU, SRU, HRU)
+// Capacity struct for capacity (MRU, SRU, HRU, CRU)
 type Capacity struct {
 	MRU uint64
 	SRU uint64
@@ -13,10 +13,25 @@ type Capacity struct {
 	CRU uint64
 }
 
-func (c *Capacity) consume(r *Request) {
-	c.MRU -= r.Capacity.MRU
-	c.HRU -= r.Capacity.HRU
-	c.SRU -= r.Capacity.SRU
+// fits checks if the request's capacity fits in the capacity
+func (c *Capacity) fits(r *Request) bool {
+	return r.Capacity.MRU <= c.MRU && r.Capacity.HRU <= c.HRU && r.Capacity.SRU <= c.SRU && r.Capacity.CRU <= c.CRU
+}
+
+// minus returns the capacity left after subtracting the other capacity, without going below zero
+func (c Capacity) minus(other Capacity) Capacity {
+	sub := func(a, b uint64) uint64 {
+		if b > a {
+			return 0
+		}
+		return a - b
+	}
+	return Capacity{
+		MRU: sub(c.MRU, other.MRU),
+		SRU: sub(c.SRU, other.SRU),
+		HRU: sub(c.HRU, other.HRU),
+		CRU: sub(c.CRU, other.CRU),
+	}
 }
 
 func freeCapacity(node *proxyTypes.Node) Capacity {
@@ -25,6 +40,9 @@ func freeCapacity(node *proxyTypes.Node) Capacity {
 	res.MRU = uint64(node.TotalResources.MRU) - uint64(node.UsedResources.MRU)
 	res.HRU = uint64(node.TotalResources.HRU) - uint64(node.UsedResources.HRU)
 	res.SRU = uint64(node.TotalResources.SRU) - uint64(node.UsedResources.SRU)
-	res.CRU = uint64(node.TotalResources.CRU) - uint64(node.UsedResources.CRU)
+	// used cru could exceed the total cru as zos allows overprovisioning cpus
+	if node.TotalResources.CRU > node.UsedResources.CRU {
+		res.CRU = node.TotalResources.CRU - node.UsedResources.CRU
+	}
 	return res
 }
@@ -10,11 +10,13 @@ import (
 var (
 	node = proxyTypes.Node{
 		UsedResources: proxyTypes.Capacity{
+			CRU: 1,
 			HRU: 1,
 			SRU: 2,
 			MRU: 3,
 		},
 		TotalResources: proxyTypes.Capacity{
+			CRU: 4,
 			HRU: 4,
 			SRU: 5,
 			MRU: 6,
@@ -27,4 +29,26 @@ func TestFreeCapacity(t *testing.T) {
 	assert.Equal(t, cap.HRU, uint64(3), "hru")
 	assert.Equal(t, cap.SRU, uint64(3), "sru")
 	assert.Equal(t, cap.MRU, uint64(3), "mru")
+	assert.Equal(t, cap.CRU, uint64(3), "cru")
+}
+
+func TestFreeCapacityOverprovisionedCRU(t *testing.T) {
+	cap := freeCapacity(&proxyTypes.Node{
+		TotalResources: proxyTypes.Capacity{CRU: 2},
+		UsedResources:  proxyTypes.Capacity{CRU: 4},
+	})
+	assert.Equal(t, cap.CRU, uint64(0), "cru")
+}
+
+func TestMinus(t *testing.T) {
+	cap := freeCapacity(&node).minus(Capacity{
+		CRU: 1,
+		HRU: 1,
+		SRU: 2,
+		MRU: 3,
+	})
+	assert.Equal(t, cap.CRU, uint64(2), "cru")
+	assert.Equal(t, cap.HRU, uint64(2), "hru")
+	assert.Equal(t, cap.SRU, uint64(1), "sru")
+	assert.Equal(t, cap.MRU, uint64(0), "mru")
 }
@@ -0,0 +1,244 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+const (
+	// pricing policies prices are in units of 10^-7 USD per hour
+	priceUnit     = 1e7
+	hoursPerMonth = 24 * 30
+	gigabyte      = 1 << 30
+
+	// certifiedFactor is the price increase of certified nodes
+	certifiedFactor = 1.25
+	// dedicatedDiscount is the discount on renting a whole node
+	dedicatedDiscount = 0.5
+)
+
+// PricingPolicy holds the prices of compute units, storage units, and public ips,
+// in units of 10^-7 USD per hour
+type PricingPolicy struct {
+	CU  uint64
+	SU  uint64
+	IPU uint64
+}
+
+// DefaultPricingPolicy is the grid's default pricing policy
+var DefaultPricingPolicy = PricingPolicy{
+	CU:  100000,
+	SU:  50000,
+	IPU: 40000,
+}
+
+// PricingSource gets the pricing policies and the TFT price, from tfchain usually
+type PricingSource interface {
+	// PricingPolicy returns the prices of the pricing policy with the given id
+	PricingPolicy(id uint32) (PricingPolicy, error)
+	// TFTPrice returns the price of a TFT in USD
+	TFTPrice() (float64, error)
+}
+
+// Pricing caches the pricing policies got from a pricing source per policy id, and the TFT price,
+// it can be shared by the schedulers of a provider process. Failures are cached too, so the source isn't queried again for them
+type Pricing struct {
+	source   PricingSource
+	mu       sync.Mutex
+	policies map[uint32]PricingPolicy
+	failures map[uint32]error
+	tftPrice float64
+	tftErr   error
+}
+
+// NewPricing creates a pricing getting the policies from the given source once
+func NewPricing(source PricingSource) *Pricing {
+	return &Pricing{
+		source:   source,
+		policies: map[uint32]PricingPolicy{},
+		failures: map[uint32]error{},
+	}
+}
+
+// policy returns the pricing policy with the given id
+func (p *Pricing) policy(id uint32) (PricingPolicy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if policy, ok := p.policies[id]; ok {
+		return policy, nil
+	}
+	if err, ok := p.failures[id]; ok {
+		return PricingPolicy{}, err
+	}
+	policy, err := p.source.PricingPolicy(id)
+	if err != nil {
+		p.failures[id] = errors.Wrapf(err, "couldn't get pricing policy %d", id)
+		return PricingPolicy{}, p.failures[id]
+	}
+	p.policies[id] = policy
+	return policy, nil
+}
+
+// tft returns the price of a TFT in USD
+func (p *Pricing) tft() (float64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tftPrice != 0 || p.tftErr != nil {
+		return p.tftPrice, p.tftErr
+	}
+	price, err := p.source.TFTPrice()
+	if err != nil {
+		p.tftErr = errors.Wrap(err, "couldn't get the TFT price")
+		return 0, p.tftErr
+	}
+	if price <= 0 {
+		p.tftErr = errors.Errorf("invalid TFT price %f", price)
+		return 0, p.tftErr
+	}
+	p.tftPrice = price
+	return price, nil
+}
+
+// computeUnits returns the compute units of the given cpus and memory
+func computeUnits(cru uint64, mru uint64) float64 {
+	cpus := float64(cru)
+	memory := float64(mru) / gigabyte
+	return math.Min(
+		math.Max(memory/4, cpus/2),
+		math.Min(
+			math.Max(memory/8, cpus),
+			math.Max(memory/2, cpus/4),
+		),
+	)
+}
+
+// storageUnits returns the storage units of the given hdd and ssd sizes
+func storageUnits(hru uint64, sru uint64) float64 {
+	return float64(hru)/gigabyte/1200 + float64(sru)/gigabyte/200
+}
+
+// MonthlyCost estimates the monthly cost in USD of the given capacity and public ips
+func MonthlyCost(capacity Capacity, publicIPs uint32, policy PricingPolicy, certified bool, dedicated bool) float64 {
+	hourly := computeUnits(capacity.CRU, capacity.MRU)*float64(policy.CU) +
+		storageUnits(capacity.HRU, capacity.SRU)*float64(policy.SU) +
+		float64(publicIPs)*float64(policy.IPU)
+
+	cost := hourly / priceUnit * hoursPerMonth
+	if certified {
+		cost *= certifiedFactor
+	}
+	if dedicated {
+		cost *= 1 - dedicatedDiscount
+	}
+	return cost
+}
+
+// monthlyCost estimates the monthly cost in USD of the request on the node,
+// dedicated requests pay for the whole node
+func (r *Request) monthlyCost(node *proxyTypes.Node, farm farmInfo) float64 {
+	capacity := r.Capacity
+	if r.Dedicated {
+		capacity = Capacity{
+			CRU: node.TotalResources.CRU,
+			MRU: uint64(node.TotalResources.MRU),
+			SRU: uint64(node.TotalResources.SRU),
+			HRU: uint64(node.TotalResources.HRU),
+		}
+	}
+	certified := node.CertificationType == "Certified"
+	return MonthlyCost(capacity, r.PublicIpsCount, farm.pricingPolicy, certified, r.Dedicated)
+}
+
+// exceedsMaxCost reports whether the request's estimated monthly cost on the node exceeds its maximum,
+// the members of an affinity group are each held to their own maximum rather than the group's whole cost
+func (r *Request) exceedsMaxCost(node *proxyTypes.Node, farm farmInfo) bool {
+	if len(r.members) == 0 {
+		return r.MaxMonthlyCost != 0 && r.monthlyCost(node, farm) > r.MaxMonthlyCost
+	}
+	for i := range r.members {
+		if r.members[i].exceedsMaxCost(node, farm) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMaxCosts makes sure the estimated monthly cost of each member of the batch on the node doesn't exceed its maximum
+func (n *Scheduler) checkMaxCosts(b batch, requests map[string]Request, node uint32) error {
+	for _, name := range b.members {
+		r := requests[name]
+		if r.MaxMonthlyCost == 0 {
+			continue
+		}
+		cost, err := n.estimateCost(&r, node)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't estimate the cost of request %s", name)
+		}
+		if cost > r.MaxMonthlyCost {
+			return fmt.Errorf("couldn't schedule request %s, its estimated monthly cost on node %d is %.2f USD which exceeds %.2f USD", name, node, cost, r.MaxMonthlyCost)
+		}
+	}
+	return nil
+}
+
+// Costs returns the estimated monthly cost in USD of each request assigned by the scheduler
+func (n *Scheduler) Costs() map[string]float64 {
+	return n.costs
+}
+
+// TFTCosts returns the estimated monthly cost in TFT of each request assigned by the scheduler,
+// it's empty if the scheduler has no pricing source to get the TFT price from
+func (n *Scheduler) TFTCosts() map[string]float64 {
+	return n.tftCosts
+}
+
+// SetPricing makes the scheduler estimate costs with the pricing policies of the given pricing,
+// otherwise the default pricing policy is used
+func (n *Scheduler) SetPricing(pricing *Pricing) {
+	n.pricing = pricing
+}
+
+// farmPricingPolicy returns the farm's pricing policy, or the default one if it couldn't be got,
+// so that failing to get it only affects the estimated costs
+func (n *Scheduler) farmPricingPolicy(id uint32) PricingPolicy {
+	if n.pricing == nil {
+		return DefaultPricingPolicy
+	}
+	policy, err := n.pricing.policy(id)
+	if err != nil {
+		log.Printf("the default pricing policy is used to estimate costs instead of pricing policy %d. %s", id, err.Error())
+		return DefaultPricingPolicy
+	}
+	return policy
+}
+
+// tftCost converts a cost in USD to TFT
+func (n *Scheduler) tftCost(cost float64) (float64, error) {
+	if n.pricing == nil {
+		return 0, errors.New("no pricing source to get the TFT price from")
+	}
+	price, err := n.pricing.tft()
+	if err != nil {
+		return 0, err
+	}
+	return cost / price, nil
+}
+
+// estimateCost estimates the monthly cost in USD of the request on the node
+func (n *Scheduler) estimateCost(r *Request, nodeID uint32) (float64, error) {
+	node, err := n.getNodeDetails(nodeID)
+	if err != nil {
+		return 0, err
+	}
+	farm, err := n.getFarmInfo(uint32(node.FarmID))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get farm %d info", node.FarmID)
+	}
+	return r.monthlyCost(&node, farm), nil
+}
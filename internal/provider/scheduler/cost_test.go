@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func TestMonthlyCost(t *testing.T) {
+	capacity := Capacity{
+		CRU: 2,
+		MRU: 4 * uint64(gridtypes.Gigabyte),
+		SRU: 50 * uint64(gridtypes.Gigabyte),
+	}
+	// 1 cu, 0.25 su, and 1 ip: (100000 + 12500 + 40000) * 720 / 10^7
+	assert.InDelta(t, MonthlyCost(capacity, 1, DefaultPricingPolicy, false, false), 10.98, 1e-9, "cost")
+	assert.InDelta(t, MonthlyCost(capacity, 1, DefaultPricingPolicy, true, false), 13.725, 1e-9, "certified cost")
+	assert.InDelta(t, MonthlyCost(capacity, 1, DefaultPricingPolicy, false, true), 5.49, 1e-9, "dedicated cost")
+	assert.Equal(t, MonthlyCost(Capacity{}, 0, DefaultPricingPolicy, false, false), float64(0), "no capacity")
+}
+
+func TestCheapestStrategyAndMaxCost(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1, CertificationType: "Certified", TotalResources: proxyTypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte}})
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 2, TotalResources: proxyTypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte}})
+	proxy.AddNode(3, proxyTypes.Node{NodeID: 3, FarmID: 1, TotalResources: proxyTypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte}})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1, PricingPolicyID: 1})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 2, PricingPolicyID: 2})
+
+	pricing := &pricingSourceMock{
+		policies: map[uint32]PricingPolicy{
+			1: DefaultPricingPolicy,
+			2: {CU: 200000, SU: 100000, IPU: 80000},
+		},
+		tftPrice: 0.02,
+	}
+
+	capacity := Capacity{CRU: 2, MRU: 4 * uint64(gridtypes.Gigabyte)}
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	scheduler.SetPricing(NewPricing(pricing))
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), []Request{
+		{Name: "cheap", Capacity: capacity, Strategy: CheapestStrategy{}},
+		{Name: "capped", Capacity: capacity, MaxMonthlyCost: 10, NodeExclude: []uint32{3}},
+	}, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, assignment["cheap"], uint32(3), "node 3 is neither certified nor on an expensive farm")
+	assert.Equal(t, assignment["capped"], uint32(1), "node 2 costs more than the max cost")
+	assert.InDelta(t, scheduler.Costs()["cheap"], 7.2, 1e-9)
+	assert.InDelta(t, scheduler.Costs()["capped"], 9, 1e-9)
+	assert.InDelta(t, scheduler.TFTCosts()["cheap"], 360, 1e-6)
+	assert.InDelta(t, scheduler.TFTCosts()["capped"], 450, 1e-6)
+	assert.Equal(t, map[uint32]int{1: 1, 2: 1}, pricing.calls, "each pricing policy is got once")
+
+	_, err = scheduler.Schedule(context.Background(), &Request{Capacity: capacity, MaxMonthlyCost: 7})
+	assert.Error(t, err, "all nodes exceed the max cost")
+}
+
+func TestPricingErrors(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	for id := 1; id <= 120; id++ {
+		proxy.AddNode(uint32(id), proxyTypes.Node{NodeID: id, FarmID: 1, TotalResources: proxyTypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte}})
+	}
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1, PricingPolicyID: 3})
+
+	// the farm's pricing policy is unknown, so the default one is used and the source is queried once
+	source := &pricingSourceMock{}
+	pricing := NewPricing(source)
+	for i := 0; i < 2; i++ {
+		scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+		scheduler.SetPricing(pricing)
+		assignment := map[string]uint32{}
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r", Capacity: Capacity{CRU: 200}},
+			{Name: "capped", Capacity: Capacity{CRU: 1}, MaxMonthlyCost: 10},
+		}, assignment)
+		assert.Error(t, err, "no node has enough cpus")
+		err = scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r", Capacity: Capacity{CRU: 1}},
+			{Name: "capped", Capacity: Capacity{CRU: 1}, MaxMonthlyCost: 10},
+		}, assignment)
+		assert.NoError(t, err)
+		assert.Equal(t, MonthlyCost(Capacity{CRU: 1}, 0, DefaultPricingPolicy, false, false), scheduler.Costs()["capped"])
+		assert.Empty(t, scheduler.TFTCosts(), "the TFT price is unknown")
+	}
+	assert.Equal(t, map[uint32]int{3: 1}, source.calls)
+	assert.Equal(t, 1, source.tftCalls)
+
+	// without a pricing source, the default pricing policy is used and no TFT costs are estimated
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), []Request{{Name: "r", Capacity: Capacity{CRU: 1}}}, assignment)
+	assert.NoError(t, err)
+	assert.Contains(t, scheduler.Costs(), "r")
+	assert.Empty(t, scheduler.TFTCosts())
+}
+
+type pricingSourceMock struct {
+	policies map[uint32]PricingPolicy
+	tftPrice float64
+	calls    map[uint32]int
+	tftCalls int
+}
+
+func (p *pricingSourceMock) PricingPolicy(id uint32) (PricingPolicy, error) {
+	if p.calls == nil {
+		p.calls = map[uint32]int{}
+	}
+	p.calls[id]++
+	policy, ok := p.policies[id]
+	if !ok {
+		return PricingPolicy{}, fmt.Errorf("pricing policy %d not found", id)
+	}
+	return policy, nil
+}
+
+func (p *pricingSourceMock) TFTPrice() (float64, error) {
+	p.tftCalls++
+	return p.tftPrice, nil
+}
@@ -0,0 +1,101 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// requirements a node could be rejected for
+const (
+	rejectMRU          = "mru"
+	rejectSRU          = "sru"
+	rejectHRU          = "hru"
+	rejectCRU          = "cru"
+	rejectFarm         = "farm"
+	rejectPublicConfig = "public_config"
+	rejectIPv4         = "ipv4"
+	rejectIPv6         = "ipv6"
+	rejectDomain       = "has_gateway_domain"
+	rejectPublicIPs    = "public_ips"
+	rejectDedicated    = "dedicated"
+	rejectRentedByMe   = "rented_by_me"
+	rejectCertified    = "certified"
+	rejectExclusion    = "exclusion"
+	rejectLocation     = "location"
+	rejectSpread       = "spread"
+	rejectCost         = "cost"
+	rejectReserved     = "reserved"
+)
+
+// Explanation records how the scheduler picked a node for a request
+type Explanation struct {
+	// Node is the node assigned to the request, zero if none was found
+	Node uint32
+	// FarmerBot is true if the node was picked by the farm's farmerbot
+	FarmerBot bool
+	// rejections maps each examined node to the requirement it doesn't satisfy, empty if it satisfies all
+	rejections map[uint32]string
+}
+
+func newExplanation() *Explanation {
+	return &Explanation{rejections: map[uint32]string{}}
+}
+
+func (e *Explanation) examine(nodeID uint32, rejection string) {
+	e.rejections[nodeID] = rejection
+}
+
+// Examined returns the number of candidate nodes examined for the request
+func (e *Explanation) Examined() int {
+	return len(e.rejections)
+}
+
+// Rejections returns the number of examined nodes rejected by each requirement
+func (e *Explanation) Rejections() map[string]int {
+	rejections := map[string]int{}
+	for _, rejection := range e.rejections {
+		if rejection != "" {
+			rejections[rejection]++
+		}
+	}
+	return rejections
+}
+
+// String returns a human readable explanation
+func (e *Explanation) String() string {
+	if e.FarmerBot {
+		return fmt.Sprintf("node %d was picked by the farmerbot", e.Node)
+	}
+
+	rejections := e.Rejections()
+	reasons := make([]string, 0, len(rejections))
+	for reason, count := range rejections {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+	}
+	sort.Strings(reasons)
+
+	var res string
+	if e.Node != 0 {
+		res = fmt.Sprintf("node %d was picked out of %d examined nodes", e.Node, e.Examined())
+	} else {
+		res = fmt.Sprintf("no node was picked out of %d examined nodes", e.Examined())
+	}
+	if len(reasons) != 0 {
+		res += fmt.Sprintf(", rejected nodes by requirement: %s", strings.Join(reasons, ", "))
+	}
+	return res
+}
+
+// Explanations returns the explanation of each request processed by the scheduler
+func (n *Scheduler) Explanations() map[string]*Explanation {
+	return n.explanations
+}
+
+// explain starts a new explanation for the request
+func (n *Scheduler) explain(r *Request) *Explanation {
+	e := newExplanation()
+	n.explanations[r.Name] = e
+	return e
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func TestRejection(t *testing.T) {
+	cap := freeCapacity(&node)
+	nodeInfo := nodeInfo{
+		FreeCapacity: &cap,
+		Node: proxyTypes.Node{
+			NodeID:  1,
+			FarmID:  1,
+			Country: "Belgium",
+		},
+	}
+	violations := map[string]Request{
+		rejectMRU:          {Capacity: Capacity{MRU: 4}},
+		rejectSRU:          {Capacity: Capacity{SRU: 4}},
+		rejectHRU:          {Capacity: Capacity{HRU: 4}},
+		rejectCRU:          {Capacity: Capacity{CRU: 4}},
+		rejectFarm:         {FarmId: 2},
+		rejectPublicConfig: {PublicConfig: true},
+		rejectPublicIPs:    {PublicIpsCount: 2},
+		rejectDedicated:    {Dedicated: true},
+		rejectCertified:    {Certified: true},
+		rejectExclusion:    {NodeExclude: []uint32{1}},
+		rejectLocation:     {Location: Location{Countries: []string{"Egypt"}}},
+		rejectSpread:       {SpreadGroup: "g", spreadExclude: []string{"1"}},
+	}
+	farm := farmInfo{freeIPs: 1}
+	for expected, r := range violations {
+		cp := r
+		assert.Equal(t, nodeInfo.rejection(&cp, farm), expected, expected)
+	}
+	assert.Equal(t, nodeInfo.rejection(&Request{}, farm), "", "node satisfies the request")
+}
+
+func TestExplanations(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1, TotalResources: proxyTypes.Capacity{MRU: 1}})
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 1, TotalResources: proxyTypes.Capacity{MRU: 1}})
+	proxy.AddNode(3, proxyTypes.Node{NodeID: 3, FarmID: 1, TotalResources: proxyTypes.Capacity{MRU: 10}})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), []Request{
+		{Name: "ok", Capacity: Capacity{MRU: 5}},
+		{Name: "fail", Capacity: Capacity{MRU: 5}, NodeExclude: []uint32{3}},
+	}, assignment)
+	assert.Error(t, err)
+
+	explanations := scheduler.Explanations()
+	assert.Equal(t, explanations["ok"].Node, uint32(3))
+
+	fail := explanations["fail"]
+	assert.Equal(t, fail.Node, uint32(0))
+	assert.Equal(t, fail.Examined(), 3)
+	assert.Equal(t, fail.Rejections(), map[string]int{rejectMRU: 2, rejectExclusion: 1})
+	assert.Equal(t, fail.String(), "no node was picked out of 3 examined nodes, rejected nodes by requirement: exclusion: 1, mru: 2")
+}
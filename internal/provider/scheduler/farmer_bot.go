@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"strconv"
@@ -16,8 +17,36 @@ const (
 	FarmerBotVersionAction  = "farmerbot.farmmanager.version"
 	FarmerBotFindNodeAction = "farmerbot.nodemanager.findnode"
 	FarmerBotRMBFunction    = "execute_job"
+
+	// farmerBotStateError is the state of a failed farmerbot job
+	farmerBotStateError = "error"
+	// farmerBotNodeIDKey is the key of the found node id in the farmerbot find node result params
+	farmerBotNodeIDKey = "nodeid"
 )
 
+// FarmerBotOptions configures the calls to the farmerbots
+type FarmerBotOptions struct {
+	// Timeout is the timeout in seconds of the farmerbot jobs
+	Timeout uint32
+	// Retries is the number of times a failed call to a farmerbot is retried
+	Retries uint32
+	// RetryInterval is the time to wait between retries
+	RetryInterval time.Duration
+	// WakeUpTimeout is the total time to wait for the nodes picked by the farmerbots to be ready, zero skips waiting
+	WakeUpTimeout time.Duration
+	// WakeUpInterval is the time to wait between checks of the node's readiness
+	WakeUpInterval time.Duration
+}
+
+// DefaultFarmerBotOptions are the farmerbot options used if not configured
+var DefaultFarmerBotOptions = FarmerBotOptions{
+	Timeout:        6000,
+	Retries:        2,
+	RetryInterval:  time.Second,
+	WakeUpTimeout:  10 * time.Minute,
+	WakeUpInterval: 10 * time.Second,
+}
+
 type FarmerBotAction struct {
 	Guid         string        `json:"guid"`
 	TwinID       uint32        `json:"twinid"`
@@ -57,10 +86,29 @@ type Params struct {
 	Value interface{} `json:"value"`
 }
 
+// callFarmerBot executes the given action on the farmerbot, retrying failed calls
+func (s *Scheduler) callFarmerBot(ctx context.Context, farmerTwinID uint32, data FarmerBotAction, output *FarmerBotAction) error {
+	var err error
+	for attempt := uint32(0); attempt <= s.farmerBotOptions.Retries; attempt++ {
+		if attempt != 0 {
+			log.Printf("retrying %s action on farmerbot with twin %d. attempt %d", data.Action, farmerTwinID, attempt)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.farmerBotOptions.RetryInterval):
+			}
+		}
+		err = s.rmbClient.Call(ctx, farmerTwinID, FarmerBotRMBFunction, data, output)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
 func (s *Scheduler) hasFarmerBot(ctx context.Context, farmID uint32) bool {
 	args := []Args{}
 	params := []Params{}
-	data := buildFarmerBotAction(farmID, uint32(s.twinID), args, params, FarmerBotVersionAction)
 
 	info, err := s.getFarmInfo(farmID)
 	if err != nil {
@@ -68,8 +116,10 @@ func (s *Scheduler) hasFarmerBot(ctx context.Context, farmID uint32) bool {
 	}
 
 	dst := info.farmerTwinID
+	data := s.buildFarmerBotAction(dst, uint32(s.twinID), args, params, FarmerBotVersionAction)
 	var output FarmerBotAction
 
+	// the ping isn't retried, as most farms don't run a farmerbot
 	err = s.rmbClient.Call(ctx, dst, FarmerBotRMBFunction, data, &output)
 	if err != nil {
 		log.Printf("error while pinging farmerbot on farm %d with farmer twin %d. %s", farmID, dst, err.Error())
@@ -84,70 +134,123 @@ func (n *Scheduler) farmerBotSchedule(ctx context.Context, r *Request) (uint32,
 		return 0, errors.Wrapf(err, "failed to get farm %d info", r.FarmId)
 	}
 	params := buildFarmerBotParams(r)
-	args := buildFarmerBotArgs(r)
-	data := buildFarmerBotAction(info.farmerTwinID, uint32(n.twinID), args, params, FarmerBotFindNodeAction)
+	args, err := buildFarmerBotArgs(r)
+	if err != nil {
+		return 0, err
+	}
+	data := n.buildFarmerBotAction(info.farmerTwinID, uint32(n.twinID), args, params, FarmerBotFindNodeAction)
 	output := FarmerBotAction{}
 
-	err = n.rmbClient.Call(ctx, info.farmerTwinID, FarmerBotRMBFunction, data, &output)
+	err = n.callFarmerBot(ctx, info.farmerTwinID, data, &output)
 	if err != nil {
 		return 0, err
 	}
-	if len(output.Result.Params) < 1 {
-		return 0, fmt.Errorf("cannot find an eligible node on farm %d", r.FarmId)
+	if output.Error != "" || output.State == farmerBotStateError {
+		return 0, fmt.Errorf("farmerbot on farm %d failed to find a node: %s", r.FarmId, output.Error)
 	}
-	nodeId, err := strconv.ParseUint(output.Result.Params[0].Value.(string), 10, 32)
+
+	nodeId, err := parseFarmerBotNodeID(output.Result.Params)
 	if err != nil {
-		return 0, err
+		return 0, errors.Wrapf(err, "cannot find an eligible node on farm %d", r.FarmId)
 	}
 	log.Printf("got a node with id %d", nodeId)
-	return uint32(nodeId), nil
-}
 
-func buildFarmerBotArgs(r *Request) []Args {
-	return []Args{}
-}
-func buildFarmerBotParams(r *Request) []Params {
-	params := []Params{}
-	if r.Capacity.HRU != 0 {
-		params = append(params, Params{Key: "required_hru", Value: r.Capacity.HRU})
-	}
-
-	if r.Capacity.SRU != 0 {
-		params = append(params, Params{Key: "required_sru", Value: r.Capacity.SRU})
+	if err := n.waitNodeReady(ctx, nodeId); err != nil {
+		return 0, err
 	}
+	return nodeId, nil
+}
 
-	if r.Capacity.MRU != 0 {
-		params = append(params, Params{Key: "required_mru", Value: r.Capacity.MRU})
+// parseFarmerBotNodeID returns the node id found by a farmerbot from its result params
+func parseFarmerBotNodeID(params []Params) (uint32, error) {
+	for _, param := range params {
+		if param.Key != farmerBotNodeIDKey {
+			continue
+		}
+		switch value := param.Value.(type) {
+		case string:
+			nodeID, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return 0, errors.Wrapf(err, "invalid node id %s", value)
+			}
+			return uint32(nodeID), nil
+		case float64:
+			return uint32(value), nil
+		default:
+			return 0, fmt.Errorf("invalid node id %v", value)
+		}
 	}
+	return 0, errors.New("farmerbot didn't return a node id")
+}
 
-	if r.Capacity.CRU != 0 {
-		params = append(params, Params{Key: "required_cru", Value: r.Capacity.CRU})
-	}
+// farmerBotRequirement is a requirement of a request sent to the farmerbots, keyed by its argument and parameter name
+type farmerBotRequirement struct {
+	key   string
+	value interface{}
+}
 
-	if len(r.NodeExclude) != 0 {
-		value := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(r.NodeExclude)), ","), "")
-		params = append(params, Params{Key: "node_exclude", Value: value})
+// farmerBotRequirements returns the requirements of the request the farmerbots support, skipping the unset ones
+func farmerBotRequirements(r *Request) []farmerBotRequirement {
+	requirements := []farmerBotRequirement{}
+	add := func(key string, set bool, value interface{}) {
+		if set {
+			requirements = append(requirements, farmerBotRequirement{key: key, value: value})
+		}
 	}
+	add("required_hru", r.Capacity.HRU != 0, r.Capacity.HRU)
+	add("required_sru", r.Capacity.SRU != 0, r.Capacity.SRU)
+	add("required_mru", r.Capacity.MRU != 0, r.Capacity.MRU)
+	add("required_cru", r.Capacity.CRU != 0, r.Capacity.CRU)
+	add("node_exclude", len(r.NodeExclude) != 0, r.NodeExclude)
+	add("dedicated", r.Dedicated, r.Dedicated)
+	add("public_config", r.PublicConfig, r.PublicConfig)
+	add("public_ips", r.PublicIpsCount > 0, r.PublicIpsCount)
+	add("certified", r.Certified, r.Certified)
+	add("countries", len(r.Location.Countries) != 0, r.Location.Countries)
+	add("cities", len(r.Location.Cities) != 0, r.Location.Cities)
+	add("regions", len(r.Location.Regions) != 0, r.Location.Regions)
+	add("exclude_countries", len(r.Location.ExcludeCountries) != 0, r.Location.ExcludeCountries)
+	add("exclude_cities", len(r.Location.ExcludeCities) != 0, r.Location.ExcludeCities)
+	add("exclude_regions", len(r.Location.ExcludeRegions) != 0, r.Location.ExcludeRegions)
+	return requirements
+}
 
-	if r.Dedicated {
-		params = append(params, Params{Key: "dedicated", Value: r.Dedicated})
+// buildFarmerBotArgs builds the find node arguments from the request's requirements,
+// the requirements without an argument, such as the location ones, are only sent as parameters
+func buildFarmerBotArgs(r *Request) ([]Args, error) {
+	values := map[string]interface{}{}
+	for _, requirement := range farmerBotRequirements(r) {
+		values[requirement.key] = requirement.value
 	}
-
-	if r.PublicConfig {
-		params = append(params, Params{Key: "public_config", Value: r.PublicConfig})
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encode farmerbot arguments")
 	}
-
-	if r.PublicIpsCount > 0 {
-		params = append(params, Params{Key: "public_ips", Value: r.PublicIpsCount})
+	args := Args{}
+	if err := json.Unmarshal(encoded, &args); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode farmerbot arguments")
 	}
+	args.PublicIPs = &r.PublicIpsCount
+	return []Args{args}, nil
+}
 
-	if r.Certified {
-		params = append(params, Params{Key: "certified", Value: r.Certified})
+// buildFarmerBotParams builds the find node parameters from the request's requirements, lists are comma separated
+func buildFarmerBotParams(r *Request) []Params {
+	params := []Params{}
+	for _, requirement := range farmerBotRequirements(r) {
+		value := requirement.value
+		switch list := value.(type) {
+		case []uint32:
+			value = strings.Trim(strings.Join(strings.Fields(fmt.Sprint(list)), ","), "")
+		case []string:
+			value = strings.Join(list, ",")
+		}
+		params = append(params, Params{Key: requirement.key, Value: value})
 	}
 	return params
 }
 
-func buildFarmerBotAction(farmerTwinID uint32, sourceTwinID uint32, args []Args, params []Params, action string) FarmerBotAction {
+func (s *Scheduler) buildFarmerBotAction(farmerTwinID uint32, sourceTwinID uint32, args []Args, params []Params, action string) FarmerBotAction {
 	return FarmerBotAction{
 		Guid:   uuid.NewString(),
 		TwinID: farmerTwinID,
@@ -165,7 +268,7 @@ func buildFarmerBotAction(farmerTwinID uint32, sourceTwinID uint32, args []Args,
 		End:          0,
 		GracePeriod:  0,
 		Error:        "",
-		Timeout:      6000,
+		Timeout:      s.farmerBotOptions.Timeout,
 		SourceTwinID: sourceTwinID,
 		Dependencies: []string{},
 	}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func TestParseFarmerBotNodeID(t *testing.T) {
+	nodeID, err := parseFarmerBotNodeID([]Params{{Key: "required_mru", Value: "1"}, {Key: "nodeid", Value: "12"}})
+	assert.NoError(t, err)
+	assert.Equal(t, nodeID, uint32(12))
+
+	nodeID, err = parseFarmerBotNodeID([]Params{{Key: "nodeid", Value: float64(13)}})
+	assert.NoError(t, err)
+	assert.Equal(t, nodeID, uint32(13))
+
+	_, err = parseFarmerBotNodeID([]Params{{Key: "nodeid", Value: "abc"}})
+	assert.Error(t, err)
+
+	_, err = parseFarmerBotNodeID([]Params{})
+	assert.Error(t, err)
+}
+
+func TestBuildFarmerBotArgs(t *testing.T) {
+	r := Request{
+		Capacity:       Capacity{MRU: 1, SRU: 2, CRU: 3},
+		PublicIpsCount: 1,
+		Dedicated:      true,
+		NodeExclude:    []uint32{4},
+	}
+	args, err := buildFarmerBotArgs(&r)
+	assert.NoError(t, err)
+	assert.Len(t, args, 1)
+	assert.Equal(t, *args[0].RequiredMRU, uint64(1))
+	assert.Equal(t, *args[0].RequiredSRU, uint64(2))
+	assert.Equal(t, *args[0].RequiredCRU, uint64(3))
+	assert.Nil(t, args[0].RequiredHRU)
+	assert.Equal(t, *args[0].PublicIPs, uint32(1))
+	assert.Equal(t, *args[0].Dedicated, true)
+	assert.Nil(t, args[0].PublicConfig)
+	assert.Nil(t, args[0].Certified)
+	assert.Equal(t, args[0].NodeExclude, []uint32{4})
+}
+
+func TestBuildFarmerBotParams(t *testing.T) {
+	r := Request{
+		Capacity:    Capacity{MRU: 1, CRU: 3},
+		Certified:   true,
+		NodeExclude: []uint32{4, 5},
+		Location:    Location{Countries: []string{"Belgium", "Egypt"}},
+	}
+	assert.Equal(t, []Params{
+		{Key: "required_mru", Value: uint64(1)},
+		{Key: "required_cru", Value: uint64(3)},
+		{Key: "node_exclude", Value: "[4,5]"},
+		{Key: "certified", Value: true},
+		{Key: "countries", Value: "Belgium,Egypt"},
+	}, buildFarmerBotParams(&r))
+
+	// the arguments are built from the same requirements
+	args, err := buildFarmerBotArgs(&r)
+	assert.NoError(t, err)
+	assert.Equal(t, *args[0].RequiredMRU, uint64(1))
+	assert.Equal(t, *args[0].RequiredCRU, uint64(3))
+	assert.Equal(t, *args[0].Certified, true)
+	assert.Equal(t, args[0].NodeExclude, []uint32{4, 5})
+	assert.Equal(t, *args[0].PublicIPs, uint32(0))
+}
+
+func farmerBotGrid() *GridProxyClientMock {
+	proxy := &GridProxyClientMock{}
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 1})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+	return proxy
+}
+
+func TestFarmerBotPublicConfig(t *testing.T) {
+	proxy := farmerBotGrid()
+	proxy.nodes[0].PublicConfig.Ipv6 = "::1"
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{hasFarmerBot: true, nodeID: 1})
+	scheduler.SetFarmerBotOptions(FarmerBotOptions{})
+	node, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1, IPv6: true})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(2), "the farmerbot node has no ipv6, so the grid proxy should be used")
+}
+
+func TestFarmerBotLocation(t *testing.T) {
+	proxy := farmerBotGrid()
+	proxy.nodes[0].Country = "Belgium"
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1, Country: "Egypt"})
+	for _, location := range []Location{
+		{Countries: []string{"Belgium"}},
+		{ExcludeCountries: []string{"Egypt"}},
+		{ExcludeRegions: []string{"africa"}},
+	} {
+		scheduler := NewScheduler(proxy, 1, &RMBClientMock{hasFarmerBot: true, nodeID: 1})
+		scheduler.SetFarmerBotOptions(FarmerBotOptions{})
+		node, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1, Location: location})
+		assert.NoError(t, err)
+		assert.Equal(t, node, uint32(2), "the farmerbot node is in a denied country, so the grid proxy should be used")
+		assert.False(t, scheduler.Explanations()["req"].FarmerBot)
+	}
+}
+
+func TestFarmerBotRetries(t *testing.T) {
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: true,
+		nodeID:       1,
+		failures:     2,
+	}
+	scheduler := NewScheduler(farmerBotGrid(), 1, rmbClient)
+	scheduler.SetFarmerBotOptions(FarmerBotOptions{Retries: 2})
+	node, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(1), "the farmerbot should find the node after retrying")
+	assert.Equal(t, rmbClient.calls, 3)
+	assert.True(t, scheduler.Explanations()["req"].FarmerBot)
+}
+
+func TestFarmerBotFallback(t *testing.T) {
+	rmbClients := map[string]*RMBClientMock{
+		"no-node":       {hasFarmerBot: true},
+		"call-failures": {hasFarmerBot: true, nodeID: 1, failures: 3},
+	}
+	for key, rmbClient := range rmbClients {
+		scheduler := NewScheduler(farmerBotGrid(), 1, rmbClient)
+		scheduler.SetFarmerBotOptions(FarmerBotOptions{Retries: 2})
+		node, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1})
+		assert.NoError(t, err, key)
+		assert.Equal(t, node, uint32(2), "%s: the grid proxy should be used to find the node", key)
+		assert.False(t, scheduler.Explanations()["req"].FarmerBot, key)
+	}
+}
@@ -0,0 +1,127 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// FetcherOptions bounds the listing of candidate nodes from the grid proxy
+type FetcherOptions struct {
+	// PageSize is the number of nodes listed per page
+	PageSize uint64
+	// Concurrency is the number of pages fetched concurrently
+	Concurrency int
+	// MaxNodes caps the number of nodes listed for a request
+	MaxNodes int
+}
+
+// DefaultFetcherOptions are the fetcher options used if not configured
+var DefaultFetcherOptions = FetcherOptions{
+	PageSize:    50,
+	Concurrency: 4,
+	MaxNodes:    2000,
+}
+
+// fetcher lists the candidate nodes of a request in rounds of concurrently fetched pages
+type fetcher struct {
+	scheduler *Scheduler
+	filter    proxyTypes.NodeFilter
+	options   FetcherOptions
+	// page is the next page to fetch
+	page uint64
+	// fetched is the number of distinct nodes listed so far
+	fetched int
+	// seen holds the ids of the nodes listed so far, as pages may overlap if nodes change between calls
+	seen map[int]bool
+	done bool
+}
+
+func (n *Scheduler) newFetcher(filter proxyTypes.NodeFilter) *fetcher {
+	options := n.fetcherOptions
+	if options.PageSize == 0 {
+		options.PageSize = DefaultFetcherOptions.PageSize
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 1
+	}
+	return &fetcher{
+		scheduler: n,
+		filter:    filter,
+		options:   options,
+		page:      1,
+		seen:      map[int]bool{},
+	}
+}
+
+// next fetches the next round of pages, and returns the nodes not listed before.
+// It returns an error if all nodes were listed, or the cap on listed nodes is reached.
+func (f *fetcher) next(ctx context.Context) ([]proxyTypes.Node, error) {
+	if f.done {
+		return nil, errors.New("couldn't find a node satisfying the given requirements")
+	}
+	left := f.options.MaxNodes - f.fetched
+	if f.options.MaxNodes != 0 && left <= 0 {
+		return nil, fmt.Errorf("couldn't find a node satisfying the given requirements among the first %d listed nodes", f.options.MaxNodes)
+	}
+
+	pages := f.options.Concurrency
+	if f.options.MaxNodes != 0 {
+		pages = min(pages, (left+int(f.options.PageSize)-1)/int(f.options.PageSize))
+	}
+	results := make([][]proxyTypes.Node, pages)
+	g, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < pages; i++ {
+		i := i
+		limit := proxyTypes.Limit{Page: f.page + uint64(i), Size: f.options.PageSize}
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			nodes, err := f.scheduler.cache.listNodes(f.scheduler.gridProxyClient, f.filter, limit)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't list nodes page %d from the grid proxy", limit.Page)
+			}
+			results[i] = nodes
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	f.page += uint64(pages)
+
+	nodes := []proxyTypes.Node{}
+	for _, page := range results {
+		// a partial page is the last one
+		if uint64(len(page)) < f.options.PageSize {
+			f.done = true
+		}
+		for _, node := range page {
+			if f.seen[node.NodeID] {
+				continue
+			}
+			f.seen[node.NodeID] = true
+			nodes = append(nodes, node)
+		}
+	}
+	if f.options.MaxNodes != 0 && len(nodes) > left {
+		nodes = nodes[:left]
+	}
+	f.fetched += len(nodes)
+	if len(nodes) == 0 && f.done {
+		return nil, errors.New("couldn't find a node satisfying the given requirements")
+	}
+	return nodes, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+// syntheticGrid creates a grid of the given size where only the last node has enough memory for bigRequest
+func syntheticGrid(size int) *GridProxyClientMock {
+	proxy := &GridProxyClientMock{}
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+	for id := 1; id <= size; id++ {
+		mru := gridtypes.Gigabyte
+		if id == size {
+			mru = 10 * gridtypes.Gigabyte
+		}
+		proxy.AddNode(uint32(id), proxyTypes.Node{
+			NodeID:         id,
+			FarmID:         1,
+			TotalResources: proxyTypes.Capacity{MRU: mru},
+		})
+	}
+	return proxy
+}
+
+var bigRequest = Request{Name: "req", Capacity: Capacity{MRU: 5 * uint64(gridtypes.Gigabyte)}}
+
+func TestFetcherEarlyStop(t *testing.T) {
+	proxy := syntheticGrid(1000)
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetFetcherOptions(FetcherOptions{PageSize: 10, Concurrency: 4})
+	node, err := scheduler.Schedule(context.Background(), &Request{Name: "req"})
+	assert.NoError(t, err)
+	assert.NotZero(t, node)
+	assert.Equal(t, proxy.nodesCalls, 4, "only the first round of pages should be fetched")
+}
+
+func TestFetcherMaxNodes(t *testing.T) {
+	proxy := syntheticGrid(100)
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetFetcherOptions(FetcherOptions{PageSize: 10, Concurrency: 4, MaxNodes: 30})
+	r := bigRequest
+	_, err := scheduler.Schedule(context.Background(), &r)
+	assert.ErrorContains(t, err, "first 30 listed nodes")
+	assert.Equal(t, proxy.nodesCalls, 3)
+
+	scheduler = NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetFetcherOptions(FetcherOptions{PageSize: 10, Concurrency: 4, MaxNodes: 100})
+	node, err := scheduler.Schedule(context.Background(), &r)
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(100))
+}
+
+func TestFetcherAllNodesListed(t *testing.T) {
+	proxy := syntheticGrid(25)
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetFetcherOptions(FetcherOptions{PageSize: 10, Concurrency: 2})
+	r := bigRequest
+	r.NodeExclude = []uint32{25}
+	_, err := scheduler.Schedule(context.Background(), &r)
+	assert.Error(t, err)
+	assert.Equal(t, proxy.nodesCalls, 4, "fetching should stop after the partial page")
+}
+
+func TestFetcherDeduplicates(t *testing.T) {
+	proxy := syntheticGrid(5)
+	for _, node := range proxy.nodes {
+		proxy.AddNode(uint32(node.NodeID), node)
+	}
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	f := scheduler.newFetcher(proxyTypes.NodeFilter{})
+	nodes, err := f.next(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 5)
+	assert.Equal(t, f.fetched, 5)
+}
+
+func TestFetcherCanceled(t *testing.T) {
+	proxy := syntheticGrid(10)
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := bigRequest
+	_, err := scheduler.Schedule(ctx, &r)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, proxy.nodesCalls, 0)
+}
+
+func BenchmarkFetcher(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		for _, latency := range []time.Duration{0, time.Millisecond} {
+			for _, concurrency := range []int{1, 4} {
+				name := fmt.Sprintf("nodes=%d/latency=%s/concurrency=%d", size, latency, concurrency)
+				b.Run(name, func(b *testing.B) {
+					proxy := syntheticGrid(size)
+					proxy.latency = latency
+					for i := 0; i < b.N; i++ {
+						scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+						scheduler.SetFetcherOptions(FetcherOptions{PageSize: 50, Concurrency: concurrency, MaxNodes: size})
+						r := bigRequest
+						if _, err := scheduler.Schedule(context.Background(), &r); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"sort"
+	"strings"
+)
+
+// Location struct for location constraints of a request
+type Location struct {
+	Countries        []string
+	Cities           []string
+	Regions          []string
+	ExcludeCountries []string
+	ExcludeCities    []string
+	ExcludeRegions   []string
+}
+
+// regions maps a region name to the countries it contains, countries are named as reported by the grid proxy
+var regions = map[string][]string{
+	"africa": {
+		"Algeria", "Angola", "Benin", "Botswana", "Burkina Faso", "Burundi", "Cameroon", "Cape Verde",
+		"Central African Republic", "Chad", "Comoros", "Congo", "Djibouti", "Egypt", "Equatorial Guinea",
+		"Eritrea", "Eswatini", "Ethiopia", "Gabon", "Gambia", "Ghana", "Guinea", "Guinea-Bissau", "Ivory Coast",
+		"Kenya", "Lesotho", "Liberia", "Libya", "Madagascar", "Malawi", "Mali", "Mauritania", "Mauritius",
+		"Morocco", "Mozambique", "Namibia", "Niger", "Nigeria", "Rwanda", "Senegal", "Seychelles",
+		"Sierra Leone", "Somalia", "South Africa", "South Sudan", "Sudan", "Tanzania", "Togo", "Tunisia",
+		"Uganda", "Zambia", "Zimbabwe",
+	},
+	"asia": {
+		"Afghanistan", "Armenia", "Azerbaijan", "Bahrain", "Bangladesh", "Bhutan", "Brunei", "Cambodia",
+		"China", "Georgia", "Hong Kong", "India", "Indonesia", "Iran", "Iraq", "Israel", "Japan", "Jordan",
+		"Kazakhstan", "Kuwait", "Kyrgyzstan", "Laos", "Lebanon", "Malaysia", "Maldives", "Mongolia", "Myanmar",
+		"Nepal", "North Korea", "Oman", "Pakistan", "Palestine", "Philippines", "Qatar", "Saudi Arabia",
+		"Singapore", "South Korea", "Sri Lanka", "Syria", "Taiwan", "Tajikistan", "Thailand", "Timor-Leste",
+		"Turkey", "Turkmenistan", "United Arab Emirates", "Uzbekistan", "Vietnam", "Yemen",
+	},
+	"europe": {
+		"Albania", "Andorra", "Austria", "Belarus", "Belgium", "Bosnia and Herzegovina", "Bulgaria",
+		"Croatia", "Cyprus", "Czechia", "Denmark", "Estonia", "Finland", "France", "Germany", "Greece",
+		"Hungary", "Iceland", "Ireland", "Italy", "Kosovo", "Latvia", "Liechtenstein", "Lithuania",
+		"Luxembourg", "Malta", "Moldova", "Monaco", "Montenegro", "Netherlands", "North Macedonia", "Norway",
+		"Poland", "Portugal", "Romania", "Russia", "San Marino", "Serbia", "Slovakia", "Slovenia", "Spain",
+		"Sweden", "Switzerland", "Ukraine", "United Kingdom", "Vatican City",
+	},
+	"north_america": {
+		"Antigua and Barbuda", "Bahamas", "Barbados", "Belize", "Canada", "Costa Rica", "Cuba", "Dominica",
+		"Dominican Republic", "El Salvador", "Grenada", "Guatemala", "Haiti", "Honduras", "Jamaica", "Mexico",
+		"Nicaragua", "Panama", "Saint Kitts and Nevis", "Saint Lucia", "Saint Vincent and the Grenadines",
+		"Trinidad and Tobago", "United States",
+	},
+	"south_america": {
+		"Argentina", "Bolivia", "Brazil", "Chile", "Colombia", "Ecuador", "Guyana", "Paraguay", "Peru",
+		"Suriname", "Uruguay", "Venezuela",
+	},
+	"oceania": {
+		"Australia", "Fiji", "Kiribati", "Marshall Islands", "Micronesia", "Nauru", "New Zealand", "Palau",
+		"Papua New Guinea", "Samoa", "Solomon Islands", "Tonga", "Tuvalu", "Vanuatu",
+	},
+}
+
+// Regions returns the sorted names of the supported regions
+func Regions() []string {
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// empty checks if there are no location constraints
+func (l *Location) empty() bool {
+	return len(l.Countries) == 0 && len(l.Cities) == 0 && len(l.Regions) == 0 &&
+		len(l.ExcludeCountries) == 0 && len(l.ExcludeCities) == 0 && len(l.ExcludeRegions) == 0
+}
+
+// allows checks if a node in the given country and city satisfies the location constraints
+func (l *Location) allows(country, city string) bool {
+	if len(l.Countries) != 0 && !containsFold(l.Countries, country) {
+		return false
+	}
+	if len(l.Cities) != 0 && !containsFold(l.Cities, city) {
+		return false
+	}
+	if len(l.Regions) != 0 && !inRegions(l.Regions, country) {
+		return false
+	}
+	if containsFold(l.ExcludeCountries, country) ||
+		containsFold(l.ExcludeCities, city) ||
+		inRegions(l.ExcludeRegions, country) {
+		return false
+	}
+	return true
+}
+
+func inRegions(names []string, country string) bool {
+	for _, name := range names {
+		if containsFold(regions[strings.ToLower(name)], country) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(elements []string, element string) bool {
+	for _, e := range elements {
+		if strings.EqualFold(e, element) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// zosVersionFunction is the rmb function used to ping a node
+const zosVersionFunction = "zos.system.version"
+
+// waitNodeReady polls a node picked by a farmerbot until it's up and reachable over rmb,
+// as the farmerbot may have to power it on first. The wake up timeout bounds the total time the scheduler
+// waits for nodes, so that requests picking sleeping nodes don't each wait for the whole timeout.
+func (n *Scheduler) waitNodeReady(ctx context.Context, nodeID uint32) error {
+	timeout := n.farmerBotOptions.WakeUpTimeout
+	if timeout == 0 {
+		return nil
+	}
+	if n.wakeUpDeadline.IsZero() {
+		n.wakeUpDeadline = time.Now().Add(timeout)
+	}
+	if time.Now().After(n.wakeUpDeadline) {
+		return fmt.Errorf("node %d isn't ready, the scheduler already waited %s for nodes to wake up", nodeID, timeout)
+	}
+	ctx, cancel := context.WithDeadline(ctx, n.wakeUpDeadline)
+	defer cancel()
+
+	start := time.Now()
+	for {
+		err := n.nodeReady(ctx, nodeID)
+		if err == nil {
+			log.Printf("node %d is ready after %s", nodeID, time.Since(start).Round(time.Second))
+			return nil
+		}
+		log.Printf("waiting for node %d to be ready (%s left): %s", nodeID, time.Until(n.wakeUpDeadline).Round(time.Second), err.Error())
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(err, "node %d isn't ready after %s", nodeID, time.Since(start).Round(time.Millisecond))
+		case <-time.After(n.farmerBotOptions.WakeUpInterval):
+		}
+	}
+}
+
+// nodeReady checks that the node is reported up by the grid proxy, and answers rmb calls
+func (n *Scheduler) nodeReady(ctx context.Context, nodeID uint32) error {
+	status, err := n.gridProxyClient.NodeStatus(nodeID)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get node status")
+	}
+	if status.Status != statusUP {
+		return fmt.Errorf("node is %s", status.Status)
+	}
+
+	node, err := n.gridProxyClient.Node(nodeID)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get node twin")
+	}
+	var version interface{}
+	if err := n.rmbClient.Call(ctx, uint32(node.TwinID), zosVersionFunction, nil, &version); err != nil {
+		return errors.Wrap(err, "node isn't reachable over rmb")
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+var wakeUpOptions = FarmerBotOptions{
+	WakeUpTimeout:  50 * time.Millisecond,
+	WakeUpInterval: time.Millisecond,
+}
+
+func TestWaitNodeReady(t *testing.T) {
+	proxy := farmerBotGrid()
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+	proxy.downPolls = 3
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{hasFarmerBot: true, nodeID: 1})
+	scheduler.SetFarmerBotOptions(wakeUpOptions)
+	node, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(1), "the farmerbot node should be used once it's up")
+	assert.Equal(t, proxy.downPolls, 0)
+}
+
+func TestWaitNodeReadyTimeout(t *testing.T) {
+	proxies := map[string]*GridProxyClientMock{
+		"down":        {downPolls: 1 << 20},
+		"unreachable": {},
+	}
+	for key, proxy := range proxies {
+		proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+		scheduler := NewScheduler(proxy, 1, &RMBClientMock{nodeID: 1, unreachable: key == "unreachable"})
+		scheduler.SetFarmerBotOptions(wakeUpOptions)
+		err := scheduler.waitNodeReady(context.Background(), 1)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestWaitNodeReadyFallback(t *testing.T) {
+	proxy := farmerBotGrid()
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{hasFarmerBot: true, nodeID: 1, unreachable: true})
+	scheduler.SetFarmerBotOptions(wakeUpOptions)
+	_, err := scheduler.Schedule(context.Background(), &Request{Name: "req", FarmId: 1, NodeExclude: []uint32{1}})
+	assert.NoError(t, err)
+	assert.False(t, scheduler.Explanations()["req"].FarmerBot, "the grid proxy should be used if the node doesn't wake up")
+}
+
+func TestWaitNodeReadyTotalTimeout(t *testing.T) {
+	proxy := &GridProxyClientMock{downPolls: 1 << 20}
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 1})
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	scheduler.SetFarmerBotOptions(wakeUpOptions)
+
+	// the second node isn't waited for, as the first one used up the wake up timeout
+	start := time.Now()
+	assert.Error(t, scheduler.waitNodeReady(context.Background(), 1))
+	assert.Error(t, scheduler.waitNodeReady(context.Background(), 2))
+	assert.Less(t, time.Since(start), 2*wakeUpOptions.WakeUpTimeout)
+}
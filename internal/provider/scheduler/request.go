@@ -21,10 +21,53 @@ type Request struct {
 	Dedicated      bool
 	NodeExclude    []uint32
 	Distinct       bool
+	Location       Location
+	Strategy       Strategy
+	SpreadGroup    string
+	SpreadBy       string
+	AffinityGroup  string
+	// IPv4, IPv6, and HasGatewayDomain require the node's public config to have an ipv4, an ipv6, or a domain
+	IPv4             bool
+	IPv6             bool
+	HasGatewayDomain bool
+	// RentedByMe restricts the request to nodes rented by the scheduler's twin, PreferRented only prefers them
+	RentedByMe   bool
+	PreferRented bool
+	// MaxMonthlyCost is the maximum estimated monthly cost in USD, zero for no limit
+	MaxMonthlyCost float64
+
+	// twinID is the twin of the scheduler handling the request
+	twinID uint64
+	// spreadExclude holds the topology domains already used by the request's spread group
+	spreadExclude []string
+	// members are the requests of the affinity group scheduled as this request, each one is held to its own MaxMonthlyCost
+	members []Request
+}
+
+func (r *Request) spreadBy() string {
+	if r.SpreadBy == "" {
+		return SpreadByNode
+	}
+	return r.SpreadBy
+}
+
+func (r *Request) strategy() Strategy {
+	if r.Strategy == nil {
+		return RandomStrategy{}
+	}
+	return r.Strategy
+}
+
+// rentRejection returns rejectRentedByMe if the request requires a node rented by its twin, and the node isn't
+func (r *Request) rentRejection(node *proxyTypes.Node) string {
+	if r.RentedByMe && uint64(node.RentedByTwinID) != r.twinID {
+		return rejectRentedByMe
+	}
+	return ""
 }
 
 func (r *Request) constructFilter(twinID uint64) (f proxyTypes.NodeFilter) {
-	// this filter only lacks certification type, which is validated after.
+	// this filter only lacks certification type and free cru, which are validated after.
 	// grid proxy should support filtering a node by certification type.
 	f.Status = &statusUP
 	f.AvailableFor = &twinID
@@ -40,15 +83,36 @@ func (r *Request) constructFilter(twinID uint64) (f proxyTypes.NodeFilter) {
 	if r.Capacity.MRU != 0 {
 		f.FreeMRU = &r.Capacity.MRU
 	}
-	if r.PublicConfig {
+	if r.Capacity.CRU != 0 {
+		// grid proxy doesn't support filtering by free cru,
+		// so only nodes with enough total cru are listed and free cru is validated after.
+		f.TotalCRU = &r.Capacity.CRU
+	}
+	if r.PublicConfig || r.HasGatewayDomain {
 		f.Domain = &trueVal
 	}
+	if r.IPv4 {
+		f.IPv4 = &trueVal
+	}
+	if r.IPv6 {
+		f.IPv6 = &trueVal
+	}
 	if r.PublicIpsCount != 0 {
 		count := uint64(r.PublicIpsCount)
 		f.FreeIPs = &count
 	}
-	if r.Dedicated {
+	if r.RentedByMe {
+		f.RentedBy = &twinID
+	} else if r.Dedicated {
 		f.Rentable = &trueVal
 	}
+	// grid proxy only supports filtering by a single country or city,
+	// other location constraints are validated after.
+	if len(r.Location.Countries) == 1 {
+		f.Country = &r.Location.Countries[0]
+	}
+	if len(r.Location.Cities) == 1 {
+		f.City = &r.Location.Cities[0]
+	}
 	return f
 }
@@ -23,16 +23,17 @@ func TestFulfilsSuccess(t *testing.T) {
 	farm := farmInfo{
 		freeIPs: 1,
 	}
-	assert.Equal(t, nodeInfo.fulfils(&Request{
+	assert.Empty(t, nodeInfo.rejection(&Request{
 		Capacity: Capacity{
 			MRU: 3,
 			SRU: 3,
 			HRU: 3,
+			CRU: 3,
 		},
 		FarmId:         1,
 		PublicIpsCount: 1,
 		PublicConfig:   false,
-	}, farm), true, "fullfil-success")
+	}, farm), "fullfil-success")
 }
 
 func TestFulfilsFail(t *testing.T) {
@@ -60,21 +61,26 @@ func TestFulfilsFail(t *testing.T) {
 	farmInfo := farmInfo{
 		freeIPs: 1,
 	}
-	assert.Equal(t, nodeInfo.fulfils(&req, farmInfo), true, "this request should be successful")
+	assert.Empty(t, nodeInfo.rejection(&req, farmInfo), "this request should be successful")
 
 	violations := map[string]func(r *Request){
 		"mru":              func(r *Request) { r.Capacity.MRU = 4 },
 		"sru":              func(r *Request) { r.Capacity.SRU = 9 },
 		"hru":              func(r *Request) { r.Capacity.HRU = 4 },
+		"cru":              func(r *Request) { r.Capacity.CRU = 4 },
 		"farm_id":          func(r *Request) { r.FarmId = 2 },
 		"public_ips_count": func(r *Request) { r.PublicIpsCount = 3 },
 		"public_config":    func(r *Request) { r.PublicConfig = true },
+		"ipv4":             func(r *Request) { r.IPv4 = true },
+		"ipv6":             func(r *Request) { r.IPv6 = true },
+		"gateway_domain":   func(r *Request) { r.HasGatewayDomain = true },
+		"rented_by_me":     func(r *Request) { r.RentedByMe, r.twinID = true, 1 },
 	}
 	for key, fn := range violations {
 		cp := req
 		fn(&cp)
 
-		assert.Equal(t, nodeInfo.fulfils(&cp, farmInfo), false, fmt.Sprintf("fullfil-fail-%s", key))
+		assert.NotEmpty(t, nodeInfo.rejection(&cp, farmInfo), fmt.Sprintf("fullfil-fail-%s", key))
 	}
 }
 
@@ -84,6 +90,7 @@ func TestConstructFilter(t *testing.T) {
 			MRU: 1,
 			SRU: 2,
 			HRU: 3,
+			CRU: 4,
 		},
 		Name:           "a",
 		FarmId:         1,
@@ -97,6 +104,7 @@ func TestConstructFilter(t *testing.T) {
 	assert.Equal(t, *con.FreeMRU, uint64(1), "construct-filter-mru")
 	assert.Equal(t, *con.FreeSRU, uint64(2), "construct-filter-sru")
 	assert.Equal(t, *con.FreeHRU, uint64(3), "construct-filter-hru")
+	assert.Equal(t, *con.TotalCRU, uint64(4), "construct-filter-cru")
 	assert.Empty(t, con.Country, "construct-filter-country")
 	assert.Empty(t, con.City, "construct-filter-city")
 	assert.Equal(t, con.FarmIDs, []uint64{uint64(r.FarmId)}, "construct-filter-farm-ids")
@@ -108,3 +116,88 @@ func TestConstructFilter(t *testing.T) {
 	assert.Empty(t, con.RentedBy, "construct-filter-rented-by")
 	assert.Equal(t, *con.AvailableFor, uint64(1), "construct-filter-available-for")
 }
+
+func TestConstructFilterPublicConfig(t *testing.T) {
+	r := Request{
+		IPv4:             true,
+		IPv6:             true,
+		HasGatewayDomain: true,
+	}
+
+	con := r.constructFilter(1)
+	assert.Equal(t, *con.IPv4, true, "construct-filter-ipv4")
+	assert.Equal(t, *con.IPv6, true, "construct-filter-ipv6")
+	assert.Equal(t, *con.Domain, true, "construct-filter-domain")
+}
+
+func TestConstructFilterRent(t *testing.T) {
+	r := Request{Dedicated: true}
+	con := r.constructFilter(1)
+	assert.Equal(t, *con.Rentable, true, "construct-filter-rentable")
+	assert.Empty(t, con.RentedBy, "construct-filter-rented-by")
+
+	r.RentedByMe = true
+	con = r.constructFilter(1)
+	assert.Empty(t, con.Rentable, "construct-filter-rented-rentable")
+	assert.Equal(t, *con.RentedBy, uint64(1), "construct-filter-rented-by")
+}
+
+func TestConstructFilterLocation(t *testing.T) {
+	r := Request{
+		Location: Location{
+			Countries: []string{"Belgium"},
+			Cities:    []string{"Ghent"},
+		},
+	}
+
+	con := r.constructFilter(1)
+	assert.Equal(t, *con.Country, "Belgium", "construct-filter-country")
+	assert.Equal(t, *con.City, "Ghent", "construct-filter-city")
+
+	r.Location.Countries = append(r.Location.Countries, "Egypt")
+	con = r.constructFilter(1)
+	assert.Empty(t, con.Country, "construct-filter-multiple-countries")
+}
+
+func TestFulfilsLocation(t *testing.T) {
+	cap := freeCapacity(&node)
+	nodeInfo := nodeInfo{
+		FreeCapacity: &cap,
+		Node: types.Node{
+			Country: "Belgium",
+			City:    "Ghent",
+		},
+	}
+	req := Request{}
+	assert.Empty(t, nodeInfo.rejection(&req, farmInfo{}), "fulfils-no-location")
+
+	accepted := map[string]Location{
+		"country":            {Countries: []string{"Egypt", "belgium"}},
+		"city":               {Cities: []string{"Ghent"}},
+		"region":             {Regions: []string{"Europe"}},
+		"exclude_country":    {ExcludeCountries: []string{"Egypt"}},
+		"exclude_city":       {ExcludeCities: []string{"Cairo"}},
+		"exclude_region":     {ExcludeRegions: []string{"africa"}},
+		"region_and_country": {Regions: []string{"europe"}, ExcludeCountries: []string{"Germany"}},
+	}
+	for key, location := range accepted {
+		cp := req
+		cp.Location = location
+		assert.Empty(t, nodeInfo.rejection(&cp, farmInfo{}), fmt.Sprintf("fulfils-location-%s", key))
+	}
+
+	rejected := map[string]Location{
+		"country":         {Countries: []string{"Egypt"}},
+		"city":            {Cities: []string{"Cairo"}},
+		"region":          {Regions: []string{"asia"}},
+		"unknown_region":  {Regions: []string{"atlantis"}},
+		"exclude_country": {ExcludeCountries: []string{"Belgium"}},
+		"exclude_city":    {ExcludeCities: []string{"ghent"}},
+		"exclude_region":  {ExcludeRegions: []string{"europe"}},
+	}
+	for key, location := range rejected {
+		cp := req
+		cp.Location = location
+		assert.NotEmpty(t, nodeInfo.rejection(&cp, farmInfo{}), fmt.Sprintf("fulfils-location-fail-%s", key))
+	}
+}
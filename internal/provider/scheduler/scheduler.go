@@ -4,7 +4,9 @@ package scheduler
 import (
 	"context"
 	"fmt"
-	"math/rand"
+	"log"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 	proxy "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/client"
@@ -19,6 +21,18 @@ type Scheduler struct {
 	twinID          uint64
 	gridProxyClient proxy.Client
 	rmbClient       rmb.Client
+	explanations    map[string]*Explanation
+	costs           map[string]float64
+	tftCosts        map[string]float64
+	cache           *Cache
+	pricing         *Pricing
+	// reservations maps the requests' names to the ids of the reservations made for them in the cache
+	reservations map[string]uint64
+
+	farmerBotOptions FarmerBotOptions
+	fetcherOptions   FetcherOptions
+	// wakeUpDeadline is when the scheduler stops waiting for nodes to wake up, set once it first waits
+	wakeUpDeadline time.Time
 }
 
 // nodeInfo related to scheduling
@@ -31,26 +45,73 @@ type farmInfo struct {
 	freeIPs           uint64
 	certificationType string
 	farmerTwinID      uint32
+	pricingPolicy     PricingPolicy
+}
+
+// rejection returns the first requirement of the request the node doesn't satisfy, or an empty string if it satisfies all
+func (node *nodeInfo) rejection(r *Request, farm farmInfo) string {
+	publicConfig := publicConfigRejection(r, &node.Node.PublicConfig)
+	switch {
+	case r.Capacity.MRU > node.FreeCapacity.MRU:
+		return rejectMRU
+	case r.Capacity.HRU > node.FreeCapacity.HRU:
+		return rejectHRU
+	case r.Capacity.SRU > node.FreeCapacity.SRU:
+		return rejectSRU
+	case r.Capacity.CRU > node.FreeCapacity.CRU:
+		return rejectCRU
+	case r.FarmId != 0 && node.Node.FarmID != int(r.FarmId):
+		return rejectFarm
+	case r.PublicConfig && node.Node.PublicConfig.Domain == "":
+		return rejectPublicConfig
+	case publicConfig != "":
+		return publicConfig
+	case r.PublicIpsCount > uint32(farm.freeIPs):
+		return rejectPublicIPs
+	case r.Dedicated && !node.Node.Dedicated:
+		return rejectDedicated
+	case r.rentRejection(&node.Node) != "":
+		return rejectRentedByMe
+	case r.Certified && node.Node.CertificationType != "Certified":
+		return rejectCertified
+	case contains(r.NodeExclude, uint32(node.Node.NodeID)):
+		return rejectExclusion
+	case !r.Location.allows(node.Node.Country, node.Node.City):
+		return rejectLocation
+	case r.SpreadGroup != "" && contains(r.spreadExclude, spreadKey(&node.Node, r.spreadBy())):
+		return rejectSpread
+	case r.exceedsMaxCost(&node.Node, farm):
+		return rejectCost
+	}
+	return ""
 }
 
-func (s *Scheduler) consumePublicIPs(farmID uint32, IPs uint32) {
-	farm := s.farms[farmID]
-	farm.freeIPs -= uint64(IPs)
+// SetFarmerBotOptions configures the calls to the farmerbots
+func (n *Scheduler) SetFarmerBotOptions(options FarmerBotOptions) {
+	n.farmerBotOptions = options
 }
 
-func (node *nodeInfo) fulfils(r *Request, farm farmInfo) bool {
-	if r.Capacity.MRU > node.FreeCapacity.MRU ||
-		r.Capacity.HRU > node.FreeCapacity.HRU ||
-		r.Capacity.SRU > node.FreeCapacity.SRU ||
-		(r.FarmId != 0 && node.Node.FarmID != int(r.FarmId)) ||
-		(r.PublicConfig && node.Node.PublicConfig.Domain == "") ||
-		(r.PublicIpsCount > uint32(farm.freeIPs)) ||
-		(r.Dedicated && !node.Node.Dedicated) ||
-		(r.Certified && node.Node.CertificationType != "Certified") ||
-		contains(r.NodeExclude, uint32(node.Node.NodeID)) {
-		return false
+// publicConfigRejection returns the first public config requirement of the request the node's public config doesn't satisfy
+func publicConfigRejection(r *Request, config *proxyTypes.PublicConfig) string {
+	switch {
+	case r.IPv4 && config.Ipv4 == "":
+		return rejectIPv4
+	case r.IPv6 && config.Ipv6 == "":
+		return rejectIPv6
+	case r.HasGatewayDomain && config.Domain == "":
+		return rejectDomain
 	}
-	return true
+	return ""
+}
+
+// SetFetcherOptions configures the listing of candidate nodes
+func (n *Scheduler) SetFetcherOptions(options FetcherOptions) {
+	n.fetcherOptions = options
+}
+
+// SetCache shares the given cache with the scheduler, so that it reuses the nodes listed and sees the capacity reserved by other schedulers
+func (n *Scheduler) SetCache(cache *Cache) {
+	n.cache = cache
 }
 
 // NewScheduler generates a new scheduler
@@ -59,14 +120,24 @@ func NewScheduler(gridProxyClient proxy.Client, twinID uint64, rmbClient rmb.Cli
 		nodes:           map[uint32]nodeInfo{},
 		gridProxyClient: gridProxyClient,
 
-		twinID:    twinID,
-		farms:     make(map[uint32]farmInfo),
-		rmbClient: rmbClient,
+		twinID:       twinID,
+		farms:        make(map[uint32]farmInfo),
+		rmbClient:    rmbClient,
+		explanations: make(map[string]*Explanation),
+		costs:        make(map[string]float64),
+		tftCosts:     make(map[string]float64),
+		reservations: make(map[string]uint64),
+		cache:        NewCache(0),
+
+		farmerBotOptions: DefaultFarmerBotOptions,
+		fetcherOptions:   DefaultFetcherOptions,
 	}
 }
 
+// getFarmInfo returns the farm's info, its free ips exclude the ones reserved by the schedulers
 func (n *Scheduler) getFarmInfo(farmID uint32) (farmInfo, error) {
 	if f, ok := n.farms[farmID]; ok {
+		f.freeIPs = n.cache.freeIPs(farmID, f.freeIPs)
 		return f, nil
 	}
 	id := uint64(farmID)
@@ -84,14 +155,16 @@ func (n *Scheduler) getFarmInfo(farmID uint32) (farmInfo, error) {
 	}
 
 	n.farms[farmID] = farmInfo{
-		freeIPs:           getPublicIPsCount(farm[0].PublicIps),
+		freeIPs:           GetPublicIPsCount(farm[0].PublicIps),
 		certificationType: farm[0].CertificationType,
 		farmerTwinID:      uint32(farm[0].TwinID),
+		pricingPolicy:     n.farmPricingPolicy(uint32(farm[0].PricingPolicyID)),
 	}
-	return n.farms[farmID], nil
+	return n.getFarmInfo(farmID)
 }
 
-func getPublicIPsCount(publicIPs []proxyTypes.PublicIP) uint64 {
+// GetPublicIPsCount returns the number of public ips that aren't reserved by a contract
+func GetPublicIPsCount(publicIPs []proxyTypes.PublicIP) uint64 {
 	freeIPs := 0
 	for _, ip := range publicIPs {
 		if ip.ContractID == 0 {
@@ -101,26 +174,68 @@ func getPublicIPsCount(publicIPs []proxyTypes.PublicIP) uint64 {
 	return uint64(freeIPs)
 }
 
-func (n *Scheduler) getNode(r *Request) uint32 {
-	nodes := make([]uint32, 0, len(n.nodes))
-	for node := range n.nodes {
-		nodes = append(nodes, node)
-	}
-	rand.Shuffle(len(nodes), func(i, j int) { nodes[i], nodes[j] = nodes[j], nodes[i] })
-	for _, node := range nodes {
-		farm, err := n.getFarmInfo(r.FarmId)
+// getNode returns the first candidate node satisfying the request according to its strategy, and reserves its resources
+func (n *Scheduler) getNode(r *Request, e *Explanation) uint32 {
+	candidates := make([]Candidate, 0, len(n.nodes))
+	farms := map[uint32]farmInfo{}
+	for _, node := range n.nodes {
+		farmID := uint32(node.Node.FarmID)
+		farm, err := n.getFarmInfo(farmID)
 		if err != nil {
+			e.examine(uint32(node.Node.NodeID), rejectFarm)
 			continue
 		}
-		nodeInfo := n.nodes[node]
-		// TODO: later add free ips check when specifying the number of ips is supported
-		if nodeInfo.fulfils(r, farm) {
+		farms[farmID] = farm
+		candidates = append(candidates, Candidate{
+			Node:         node.Node,
+			FreeCapacity: n.cache.freeCapacity(uint32(node.Node.NodeID), *node.FreeCapacity),
+			Cost:         r.monthlyCost(&node.Node, farm),
+		})
+	}
+	// strategies must get the candidates in the same order to produce reproducible plans
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Node.NodeID < candidates[j].Node.NodeID })
+	r.strategy().Order(candidates)
+	if r.PreferRented {
+		// nodes already rented by the twin come first, keeping the strategy's order otherwise
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return uint64(candidates[i].Node.RentedByTwinID) == n.twinID && uint64(candidates[j].Node.RentedByTwinID) != n.twinID
+		})
+	}
+
+	for _, candidate := range candidates {
+		node := uint32(candidate.Node.NodeID)
+		info := nodeInfo{FreeCapacity: &candidate.FreeCapacity, Node: candidate.Node}
+		rejection := info.rejection(r, farms[uint32(candidate.Node.FarmID)])
+		if rejection == "" && !n.reserve(r, node) {
+			rejection = rejectReserved
+		}
+		e.examine(node, rejection)
+		if rejection == "" {
 			return node
 		}
 	}
 	return 0
 }
 
+// reserve reserves the request's resources on the node, it fails if another scheduler sharing the cache reserved them first
+func (n *Scheduler) reserve(r *Request, nodeID uint32) bool {
+	info := n.nodes[nodeID]
+	farmID := uint32(info.Node.FarmID)
+	id, ok := n.cache.reserve(nodeID, *info.FreeCapacity, farmID, n.farms[farmID].freeIPs, r)
+	if ok {
+		n.reservations[r.Name] = id
+	}
+	return ok
+}
+
+// release releases the resources reserved for the request, so that a request failing later checks doesn't hold them
+func (n *Scheduler) release(r *Request) {
+	if id, ok := n.reservations[r.Name]; ok {
+		n.cache.release(id)
+		delete(n.reservations, r.Name)
+	}
+}
+
 func (n *Scheduler) addNodes(nodes []proxyTypes.Node) {
 	for _, node := range nodes {
 		if _, ok := n.nodes[uint32(node.NodeID)]; !ok {
@@ -135,44 +250,83 @@ func (n *Scheduler) addNodes(nodes []proxyTypes.Node) {
 
 // Schedule makes sure there's at least one node that satisfies the given request
 func (n *Scheduler) Schedule(ctx context.Context, r *Request) (uint32, error) {
+	r.twinID = n.twinID
+	e := n.explain(r)
 	if r.FarmId != 0 {
 		if n.hasFarmerBot(ctx, r.FarmId) {
-			return n.farmerBotSchedule(ctx, r)
+			node, err := n.farmerBotSchedule(ctx, r)
+			if err == nil {
+				err = n.checkFarmerBotNode(r, node)
+			}
+			if err == nil {
+				e.FarmerBot = true
+				e.Node = node
+				n.reservations[r.Name] = n.cache.recordReservation(node, r.FarmId, r)
+				return node, nil
+			}
+			log.Printf("falling back to the grid proxy to schedule request %s. %s", r.Name, err.Error())
 		}
 	}
-	return n.gridProxySchedule(r)
+	node, err := n.gridProxySchedule(ctx, r, e)
+	e.Node = node
+	return node, err
 }
 
-func (n *Scheduler) gridProxySchedule(r *Request) (uint32, error) {
-	f := r.constructFilter(n.twinID)
-	l := proxyTypes.Limit{
-		Size:     10,
-		Page:     1,
-		RetCount: false,
+// checkFarmerBotNode makes sure the node picked by a farmerbot satisfies the requirements farmerbots don't support,
+// the location constraints are sent as farmerbot params too, but farmerbots don't know them
+func (n *Scheduler) checkFarmerBotNode(r *Request, nodeID uint32) error {
+	if !r.IPv4 && !r.IPv6 && !r.HasGatewayDomain && !r.RentedByMe && r.Location.empty() {
+		return nil
+	}
+	node, err := n.getNodeDetails(nodeID)
+	if err != nil {
+		return err
+	}
+	rejection := publicConfigRejection(r, &node.PublicConfig)
+	if rejection == "" {
+		rejection = r.rentRejection(&node)
+	}
+	if rejection == "" && !r.Location.allows(node.Country, node.City) {
+		rejection = rejectLocation
+	}
+	if rejection != "" {
+		return fmt.Errorf("node %d doesn't satisfy the %s requirement", nodeID, rejection)
 	}
+	return nil
+}
 
-	node := n.getNode(r)
+func (n *Scheduler) gridProxySchedule(ctx context.Context, r *Request, e *Explanation) (uint32, error) {
+	filter := r.constructFilter(n.twinID)
+	if r.PreferRented && !r.RentedByMe {
+		n.addRentedNodes(ctx, filter)
+	}
+	f := n.newFetcher(filter)
+
+	node := n.getNode(r, e)
 	for node == 0 {
-		nodes, _, err := n.gridProxyClient.Nodes(f, l)
+		nodes, err := f.next(ctx)
 		if err != nil {
-			return 0, errors.Wrap(err, "couldn't list nodes from the grid proxy")
-		}
-		if len(nodes) == 0 {
-			return 0, errors.New("couldn't find a node satisfying the given requirements")
+			return 0, err
 		}
 		n.addNodes(nodes)
-		node = n.getNode(r)
-		if l.Page == 1 && l.Size == 10 {
-			l.Page = 2
-		} else {
-			l.Size *= 2
-		}
+		node = n.getNode(r, e)
 	}
-	n.nodes[node].FreeCapacity.consume(r)
-	n.consumePublicIPs(r.FarmId, r.PublicIpsCount)
 	return node, nil
 }
 
+// addRentedNodes lists the nodes rented by the twin satisfying the filter first, so that they can be preferred
+func (n *Scheduler) addRentedNodes(ctx context.Context, filter proxyTypes.NodeFilter) {
+	filter.RentedBy = &n.twinID
+	filter.Rentable = nil
+	nodes, err := n.newFetcher(filter).next(ctx)
+	if err != nil {
+		log.Printf("no nodes rented by twin %d were listed. %s", n.twinID, err.Error())
+		return
+	}
+	n.addNodes(nodes)
+}
+
+// ProcessRequests assigns a node to each request that isn't in the given assignment
 func (s *Scheduler) ProcessRequests(ctx context.Context, reqs []Request, assignment map[string]uint32) error {
 	assignedNodes := []uint32{}
 	for _, node := range assignment {
@@ -181,15 +335,100 @@ func (s *Scheduler) ProcessRequests(ctx context.Context, reqs []Request, assignm
 		}
 	}
 
+	groups := spreadGroups{}
+	affinityNodes := map[string]uint32{}
+	affinityMembers := map[string][]Request{}
+	pending := []Request{}
+	requests := map[string]Request{}
 	for _, r := range reqs {
+		requests[r.Name] = r
+		if err := validateSpread(&r); err != nil {
+			return err
+		}
+		node, ok := assignment[r.Name]
+		if !ok {
+			pending = append(pending, r)
+			continue
+		}
+		if r.AffinityGroup != "" {
+			if pinned, ok := affinityNodes[r.AffinityGroup]; ok && pinned != node {
+				return fmt.Errorf("conflicting nodes %d and %d are assigned to the requests of affinity group %s", pinned, node, r.AffinityGroup)
+			}
+			affinityNodes[r.AffinityGroup] = node
+			affinityMembers[r.AffinityGroup] = append(affinityMembers[r.AffinityGroup], r)
+		}
+		if r.SpreadGroup == "" {
+			continue
+		}
+		details, err := s.getNodeDetails(node)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't get the assigned node of request %s", r.Name)
+		}
+		groups.add(r.SpreadGroup, details)
+	}
+
+	// already assigned requests are skipped
+	batches, err := batchRequests(pending)
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		r := b.request
+		if pinned, ok := affinityNodes[r.AffinityGroup]; ok {
+			// the rest of the affinity group must join its already assigned members, under the constraints of the whole group
+			for _, member := range affinityMembers[r.AffinityGroup] {
+				if err := r.mergeConstraints(&member); err != nil {
+					return errors.Wrapf(err, "couldn't add request %s to affinity group %s", member.Name, r.AffinityGroup)
+				}
+			}
+			nodes, keys, err := s.affinityExclusions(&r, requests, assignment)
+			if err != nil {
+				return err
+			}
+			if r.Distinct {
+				r.NodeExclude = append(r.NodeExclude, nodes...)
+			}
+			r.spreadExclude = keys
+			err = s.scheduleOn(&r, pinned)
+			s.explainMembers(b)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't schedule request %s on node %d of its affinity group %s", r.Name, pinned, r.AffinityGroup)
+			}
+			s.assign(b, requests, pinned, assignment)
+			continue
+		}
+
 		if r.Distinct {
 			r.NodeExclude = append(r.NodeExclude, assignedNodes...)
 		}
+		r.spreadExclude = groups.usedKeys(&r)
 		node, err := s.Schedule(ctx, &r)
+		s.explainMembers(b)
+		if err != nil && len(r.spreadExclude) != 0 {
+			return errors.Wrapf(err, "couldn't schedule request %s on a %s not used by spread group %s, used: %v", r.Name, r.spreadBy(), r.SpreadGroup, r.spreadExclude)
+		}
 		if err != nil {
 			return errors.Wrapf(err, "couldn't schedule request %s", r.Name)
 		}
-		assignment[r.Name] = node
+		if r.SpreadGroup != "" {
+			details, err := s.getNodeDetails(node)
+			if err != nil {
+				s.release(&r)
+				return errors.Wrapf(err, "couldn't get the assigned node of request %s", r.Name)
+			}
+			// nodes picked by a farmerbot aren't filtered by the spread constraint, so it's checked here
+			if key := spreadKey(&details, r.spreadBy()); contains(r.spreadExclude, key) {
+				s.release(&r)
+				return fmt.Errorf("couldn't schedule request %s, node %d is on %s %s which is already used by spread group %s", r.Name, node, r.spreadBy(), key, r.SpreadGroup)
+			}
+			groups.add(r.SpreadGroup, details)
+		}
+		// nodes picked by a farmerbot aren't filtered by their cost, so it's checked here
+		if err := s.checkMaxCosts(b, requests, node); err != nil {
+			s.release(&r)
+			return err
+		}
+		s.assign(b, requests, node, assignment)
 		if !contains(assignedNodes, node) {
 			assignedNodes = append(assignedNodes, node)
 		}
@@ -197,6 +436,56 @@ func (s *Scheduler) ProcessRequests(ctx context.Context, reqs []Request, assignm
 	return nil
 }
 
+// affinityExclusions returns the nodes and the spread group's topology domains used by the assigned requests
+// outside of the request's affinity group, its members share their node so they don't exclude it
+func (s *Scheduler) affinityExclusions(r *Request, requests map[string]Request, assignment map[string]uint32) ([]uint32, []string, error) {
+	nodes := []uint32{}
+	keys := []string{}
+	for name, node := range assignment {
+		other := requests[name]
+		if other.AffinityGroup == r.AffinityGroup {
+			continue
+		}
+		if !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+		if r.SpreadGroup == "" || other.SpreadGroup != r.SpreadGroup {
+			continue
+		}
+		details, err := s.getNodeDetails(node)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "couldn't get the assigned node of request %s", name)
+		}
+		if key := spreadKey(&details, r.spreadBy()); !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return nodes, keys, nil
+}
+
+// assign assigns the node to each member of the batch, and estimates their costs
+func (s *Scheduler) assign(b batch, requests map[string]Request, node uint32, assignment map[string]uint32) {
+	for _, name := range b.members {
+		assignment[name] = node
+		r := requests[name]
+		cost, err := s.estimateCost(&r, node)
+		if err != nil {
+			log.Printf("couldn't estimate the cost of request %s on node %d. %s", name, node, err.Error())
+			continue
+		}
+		s.costs[name] = cost
+		if s.pricing == nil {
+			continue
+		}
+		tftCost, err := s.tftCost(cost)
+		if err != nil {
+			log.Printf("couldn't estimate the cost in TFT of request %s. %s", name, err.Error())
+			continue
+		}
+		s.tftCosts[name] = tftCost
+	}
+}
+
 func contains[T comparable](elements []T, element T) bool {
 	for _, e := range elements {
 		if element == e {
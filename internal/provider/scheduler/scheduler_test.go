@@ -4,24 +4,45 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
 )
 
 type GridProxyClientMock struct {
 	farms []proxyTypes.Farm
 	nodes []proxyTypes.Node
+	// downPolls is the number of status checks reporting nodes down before they are up
+	downPolls int
+	// nodesCalls is the number of nodes listings
+	nodesCalls int
+	// latency is the time each nodes listing takes
+	latency time.Duration
+	mu      sync.Mutex
 }
 
 type RMBClientMock struct {
 	nodeID       uint32
 	hasFarmerBot bool
+	// failures is the number of find node calls failing before succeeding
+	failures int
+	calls    int
+	// unreachable makes nodes fail to answer rmb calls
+	unreachable bool
 }
 
 func (r *RMBClientMock) Call(ctx context.Context, twin uint32, fn string, data interface{}, result interface{}) error {
+	if fn == zosVersionFunction {
+		if r.unreachable {
+			return errors.New("node is unreachable")
+		}
+		return nil
+	}
 	d := data.(FarmerBotAction)
 	switch d.Action {
 	case FarmerBotVersionAction:
@@ -30,11 +51,16 @@ func (r *RMBClientMock) Call(ctx context.Context, twin uint32, fn string, data i
 		}
 		return errors.New("this farm does not have a farmer bot")
 	case FarmerBotFindNodeAction:
+		r.calls++
+		if r.calls <= r.failures {
+			return errors.New("farmerbot timed out")
+		}
+		output := result.(*FarmerBotAction)
 		if r.nodeID == 0 {
-			d.Error = "could not find node"
+			output.Error = "could not find node"
+			output.State = farmerBotStateError
 			return nil
 		}
-		output := result.(*FarmerBotAction)
 
 		output.Result.Params = append(output.Args.Params, Params{Key: "nodeid", Value: strconv.FormatUint(uint64(r.nodeID), 10)})
 		return nil
@@ -48,26 +74,50 @@ func (m *GridProxyClientMock) Ping() error {
 }
 
 func (m *GridProxyClientMock) Nodes(filter proxyTypes.NodeFilter, pagination proxyTypes.Limit) (res []proxyTypes.Node, totalCount int, err error) {
+	m.mu.Lock()
+	m.nodesCalls++
+	m.mu.Unlock()
+	time.Sleep(m.latency)
+	nodes := make([]proxyTypes.Node, 0, len(m.nodes))
+	for _, node := range m.nodes {
+		if filter.NodeID != nil && uint64(node.NodeID) != *filter.NodeID {
+			continue
+		}
+		if filter.AvailableFor != nil && node.RentedByTwinID != 0 && uint64(node.RentedByTwinID) != *filter.AvailableFor {
+			continue
+		}
+		if filter.RentedBy != nil && uint64(node.RentedByTwinID) != *filter.RentedBy {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
 	start, end := (pagination.Page-1)*pagination.Size, pagination.Page*pagination.Size
-	if int(end) > len(m.nodes) {
-		end = uint64(len(m.nodes))
+	if int(end) > len(nodes) {
+		end = uint64(len(nodes))
 	}
 	if end <= start {
 		return make([]proxyTypes.Node, 0), 0, nil
 	}
-	res = m.nodes[start:end]
+	res = nodes[start:end]
 	return
 }
 
 func (m *GridProxyClientMock) Farms(filter proxyTypes.FarmFilter, pagination proxyTypes.Limit) (res []proxyTypes.Farm, totalCount int, err error) {
+	farms := make([]proxyTypes.Farm, 0, len(m.farms))
+	for _, farm := range m.farms {
+		if filter.FarmID != nil && uint64(farm.FarmID) != *filter.FarmID {
+			continue
+		}
+		farms = append(farms, farm)
+	}
 	start, end := (pagination.Page-1)*pagination.Size, pagination.Page*pagination.Size
-	if int(end) > len(m.nodes) {
-		end = uint64(len(m.nodes))
+	if int(end) > len(farms) {
+		end = uint64(len(farms))
 	}
 	if end <= start {
 		return make([]proxyTypes.Farm, 0), 0, nil
 	}
-	res = m.farms[start:end]
+	res = farms[start:end]
 	return
 }
 
@@ -75,6 +125,11 @@ func (m *GridProxyClientMock) Node(nodeID uint32) (res proxyTypes.NodeWithNested
 	for _, node := range m.nodes {
 		if uint32(node.NodeID) == nodeID {
 			res = proxyTypes.NodeWithNestedCapacity{
+				NodeID:       node.NodeID,
+				FarmID:       node.FarmID,
+				Country:      node.Country,
+				City:         node.City,
+				PublicConfig: node.PublicConfig,
 				Capacity: proxyTypes.CapacityResult{
 					Total: node.TotalResources,
 					Used:  node.UsedResources,
@@ -88,6 +143,12 @@ func (m *GridProxyClientMock) Node(nodeID uint32) (res proxyTypes.NodeWithNested
 }
 
 func (m *GridProxyClientMock) NodeStatus(nodeID uint32) (res proxyTypes.NodeStatus, err error) {
+	if m.downPolls > 0 {
+		m.downPolls--
+		res.Status = "down"
+		return
+	}
+	res.Status = statusUP
 	return
 }
 
@@ -491,3 +552,567 @@ func TestDistinctNodes(t *testing.T) {
 	assert.NotEqual(t, assignment["r1"], assignment["r3"])
 	assert.NotEqual(t, assignment["r2"], assignment["r3"])
 }
+
+func TestCRUExhaustion(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{
+		NodeID: 1,
+		FarmID: 1,
+		TotalResources: proxyTypes.Capacity{
+			CRU: 8,
+			MRU: 100,
+		},
+		UsedResources: proxyTypes.Capacity{
+			CRU: 2,
+		},
+	})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+	})
+	requests := []Request{
+		{
+			Name:     "r1",
+			Capacity: Capacity{CRU: 4, MRU: 10},
+		},
+		{
+			Name:     "r2",
+			Capacity: Capacity{CRU: 2, MRU: 10},
+		},
+	}
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), requests, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, assignment["r1"], uint32(1))
+	assert.Equal(t, assignment["r2"], uint32(1))
+
+	// the node's 6 free cpus are all consumed by the previous requests
+	err = scheduler.ProcessRequests(context.Background(), []Request{
+		{
+			Name:     "r3",
+			Capacity: Capacity{CRU: 1, MRU: 10},
+		},
+	}, assignment)
+	assert.Error(t, err, "node cpus would be overloaded")
+
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	assignment = map[string]uint32{}
+	err = scheduler.ProcessRequests(context.Background(), []Request{
+		{
+			Name:     "r1",
+			Capacity: Capacity{CRU: 4},
+		},
+		{
+			Name:     "r2",
+			Capacity: Capacity{CRU: 3},
+		},
+	}, assignment)
+	assert.Error(t, err, "second request exceeds the node's remaining cpus")
+}
+
+func TestLocationConstraints(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{
+		NodeID:  1,
+		FarmID:  1,
+		Country: "Egypt",
+		City:    "Cairo",
+	})
+	proxy.AddNode(2, proxyTypes.Node{
+		NodeID:  2,
+		FarmID:  1,
+		Country: "Belgium",
+		City:    "Ghent",
+	})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+	})
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), []Request{
+		{
+			Name:     "eu",
+			Location: Location{Regions: []string{"europe"}},
+		},
+		{
+			Name:     "not-eu",
+			Location: Location{ExcludeRegions: []string{"europe"}},
+		},
+		{
+			Name:     "cairo",
+			Location: Location{Cities: []string{"Cairo"}},
+		},
+	}, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, assignment["eu"], uint32(2))
+	assert.Equal(t, assignment["not-eu"], uint32(1))
+	assert.Equal(t, assignment["cairo"], uint32(1))
+
+	_, err = scheduler.Schedule(context.Background(), &Request{
+		Location: Location{Countries: []string{"Germany"}},
+	})
+	assert.Error(t, err, "no node in germany")
+}
+
+func TestFarmerBotLocationParams(t *testing.T) {
+	params := buildFarmerBotParams(&Request{
+		Location: Location{
+			Countries:      []string{"Belgium", "Egypt"},
+			ExcludeRegions: []string{"asia"},
+		},
+	})
+	assert.Equal(t, params, []Params{
+		{Key: "countries", Value: "Belgium,Egypt"},
+		{Key: "exclude_regions", Value: "asia"},
+	})
+}
+
+func TestStrategies(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	for id, used := range map[int]gridtypes.Unit{1: 2, 2: 8, 3: 5} {
+		proxy.AddNode(uint32(id), proxyTypes.Node{
+			NodeID:         id,
+			FarmID:         1,
+			TotalResources: proxyTypes.Capacity{MRU: 10},
+			UsedResources:  proxyTypes.Capacity{MRU: used},
+		})
+	}
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+	})
+
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	node, err := scheduler.Schedule(context.Background(), &Request{
+		Capacity: Capacity{MRU: 1},
+		Strategy: BinPackStrategy{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(2), "binpack should pick the most used node")
+
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	node, err = scheduler.Schedule(context.Background(), &Request{
+		Capacity: Capacity{MRU: 1},
+		Strategy: SpreadStrategy{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(1), "spread should pick the least used node")
+
+	// binpack keeps filling the same node until it's full
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	assignment := map[string]uint32{}
+	err = scheduler.ProcessRequests(context.Background(), []Request{
+		{Name: "r1", Capacity: Capacity{MRU: 1}, Strategy: BinPackStrategy{}},
+		{Name: "r2", Capacity: Capacity{MRU: 1}, Strategy: BinPackStrategy{}},
+		{Name: "r3", Capacity: Capacity{MRU: 2}, Strategy: BinPackStrategy{}},
+	}, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint32{"r1": 2, "r2": 2, "r3": 3}, assignment)
+}
+
+func TestSpreadGroups(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	nodes := []proxyTypes.Node{
+		{NodeID: 1, FarmID: 1, Country: "Belgium"},
+		{NodeID: 2, FarmID: 1, Country: "Belgium"},
+		{NodeID: 3, FarmID: 2, Country: "Belgium"},
+		{NodeID: 4, FarmID: 3, Country: "Egypt"},
+	}
+	for _, node := range nodes {
+		proxy.AddNode(uint32(node.NodeID), node)
+	}
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 2})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 3})
+
+	farmOf := map[uint32]int{}
+	countryOf := map[uint32]string{}
+	for _, node := range nodes {
+		farmOf[uint32(node.NodeID)] = node.FarmID
+		countryOf[uint32(node.NodeID)] = node.Country
+	}
+
+	t.Run("farm", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{}
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r1", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+			{Name: "r2", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+			{Name: "r3", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+		}, assignment)
+		assert.NoError(t, err)
+		farms := map[int]bool{}
+		for _, node := range assignment {
+			farms[farmOf[node]] = true
+		}
+		assert.Len(t, farms, 3, "each request should be on a different farm")
+
+		err = scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r1", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+			{Name: "r2", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+			{Name: "r3", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+			{Name: "r4", SpreadGroup: "g", SpreadBy: SpreadByFarm},
+		}, assignment)
+		assert.ErrorContains(t, err, "spread group g")
+	})
+
+	t.Run("country", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{}
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r1", SpreadGroup: "g", SpreadBy: SpreadByCountry},
+			{Name: "r2", SpreadGroup: "g", SpreadBy: SpreadByCountry},
+		}, assignment)
+		assert.NoError(t, err)
+		assert.NotEqual(t, countryOf[assignment["r1"]], countryOf[assignment["r2"]])
+	})
+
+	t.Run("previously-assigned", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{"r1": 4}
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r1", SpreadGroup: "g", SpreadBy: SpreadByCountry},
+			{Name: "r2", SpreadGroup: "g", SpreadBy: SpreadByCountry},
+			{Name: "other", SpreadGroup: "h", SpreadBy: SpreadByCountry},
+		}, assignment)
+		assert.NoError(t, err)
+		assert.Equal(t, countryOf[assignment["r2"]], "Belgium")
+		assert.Equal(t, assignment["r1"], uint32(4))
+	})
+
+	t.Run("node", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{}
+		reqs := []Request{}
+		for i := 0; i < 4; i++ {
+			reqs = append(reqs, Request{Name: fmt.Sprintf("r%d", i), SpreadGroup: "g"})
+		}
+		err := scheduler.ProcessRequests(context.Background(), reqs, assignment)
+		assert.NoError(t, err)
+		used := map[uint32]bool{}
+		for _, node := range assignment {
+			used[node] = true
+		}
+		assert.Len(t, used, 4, "each request should be on a different node")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "r1", SpreadGroup: "g", SpreadBy: "rack"},
+		}, map[string]uint32{})
+		assert.Error(t, err)
+	})
+}
+
+func TestAffinityGroups(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{
+		NodeID:         1,
+		FarmID:         1,
+		TotalResources: proxyTypes.Capacity{MRU: 10, HRU: 100},
+	})
+	proxy.AddNode(2, proxyTypes.Node{
+		NodeID:         2,
+		FarmID:         1,
+		TotalResources: proxyTypes.Capacity{MRU: 5, HRU: 5},
+	})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+	})
+
+	// each request fits on both nodes, but together they only fit on node 1
+	requests := []Request{
+		{Name: "vm", AffinityGroup: "g", Capacity: Capacity{MRU: 4}},
+		{Name: "zdb", AffinityGroup: "g", Capacity: Capacity{HRU: 50}},
+		{Name: "disk", AffinityGroup: "g", Capacity: Capacity{MRU: 4, HRU: 1}},
+	}
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	assignment := map[string]uint32{}
+	err := scheduler.ProcessRequests(context.Background(), requests, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint32{"vm": 1, "zdb": 1, "disk": 1}, assignment)
+
+	// a new member joins the already assigned members
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	requests = append(requests, Request{Name: "disk2", AffinityGroup: "g", Capacity: Capacity{HRU: 1}})
+	err = scheduler.ProcessRequests(context.Background(), requests, assignment)
+	assert.NoError(t, err)
+	assert.Equal(t, assignment["disk2"], uint32(1))
+
+	// a new member that doesn't fit on the group's node fails
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	requests = append(requests, Request{Name: "big", AffinityGroup: "g", Capacity: Capacity{MRU: 11}})
+	err = scheduler.ProcessRequests(context.Background(), requests, assignment)
+	assert.Error(t, err)
+
+	// the group doesn't fit on any node
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	err = scheduler.ProcessRequests(context.Background(), []Request{
+		{Name: "vm", AffinityGroup: "g", Capacity: Capacity{MRU: 6}},
+		{Name: "vm2", AffinityGroup: "g", Capacity: Capacity{MRU: 6}},
+	}, map[string]uint32{})
+	assert.Error(t, err)
+}
+
+func TestAffinityGroupsMaxCost(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{
+		NodeID:         1,
+		FarmID:         1,
+		TotalResources: proxyTypes.Capacity{CRU: 8, MRU: 16 * gridtypes.Gigabyte},
+	})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+	})
+
+	// each member is held to its own max cost, whatever its order in the group
+	cheap := Request{Name: "cheap", AffinityGroup: "g", Capacity: Capacity{CRU: 1, MRU: uint64(gridtypes.Gigabyte)}, MaxMonthlyCost: 5}
+	big := Request{Name: "big", AffinityGroup: "g", Capacity: Capacity{CRU: 4, MRU: 8 * uint64(gridtypes.Gigabyte)}}
+	capped := Request{Name: "capped", AffinityGroup: "g", Capacity: Capacity{CRU: 1, MRU: uint64(gridtypes.Gigabyte)}, MaxMonthlyCost: 1}
+	for _, requests := range [][]Request{{cheap, big}, {big, cheap}} {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{}
+		err := scheduler.ProcessRequests(context.Background(), requests, assignment)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]uint32{"cheap": 1, "big": 1}, assignment)
+		assert.InDelta(t, 3.6, scheduler.Costs()["cheap"], 1e-9)
+	}
+	for _, requests := range [][]Request{{big, capped}, {capped, big}} {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), requests, map[string]uint32{})
+		assert.Error(t, err, "capped costs more than its max cost on the only node")
+	}
+
+	// a member joining the assigned ones is held to its own max cost too
+	scheduler := NewScheduler(proxy, 1, rmbClient)
+	err := scheduler.ProcessRequests(context.Background(), []Request{big, capped}, map[string]uint32{"big": 1})
+	assert.Error(t, err)
+	scheduler = NewScheduler(proxy, 1, rmbClient)
+	err = scheduler.ProcessRequests(context.Background(), []Request{big, cheap}, map[string]uint32{"big": 1})
+	assert.NoError(t, err)
+}
+
+func TestPinnedAffinityGroups(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1, TotalResources: proxyTypes.Capacity{MRU: 10}})
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 2, TotalResources: proxyTypes.Capacity{MRU: 10}})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 2})
+
+	t.Run("conflicting-nodes", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "vm", AffinityGroup: "g"},
+			{Name: "zdb", AffinityGroup: "g"},
+		}, map[string]uint32{"vm": 1, "zdb": 2})
+		assert.Error(t, err)
+	})
+
+	t.Run("assigned-members-constraints", func(t *testing.T) {
+		// the assigned member requires farm 2, so the group's node on farm 1 doesn't satisfy the group anymore
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "vm", AffinityGroup: "g", FarmId: 2},
+			{Name: "disk", AffinityGroup: "g"},
+		}, map[string]uint32{"vm": 1})
+		assert.Error(t, err)
+
+		scheduler = NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{"vm": 2}
+		err = scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "vm", AffinityGroup: "g", FarmId: 2},
+			{Name: "disk", AffinityGroup: "g"},
+		}, assignment)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(2), assignment["disk"])
+	})
+
+	t.Run("distinct", func(t *testing.T) {
+		// the group is distinct, so it can't share its node with other requests
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "other"},
+			{Name: "vm", AffinityGroup: "g", Distinct: true},
+			{Name: "disk", AffinityGroup: "g"},
+		}, map[string]uint32{"other": 1, "vm": 1})
+		assert.Error(t, err)
+
+		scheduler = NewScheduler(proxy, 1, rmbClient)
+		assignment := map[string]uint32{"other": 2, "vm": 1}
+		err = scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "other"},
+			{Name: "vm", AffinityGroup: "g", Distinct: true},
+			{Name: "disk", AffinityGroup: "g"},
+		}, assignment)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(1), assignment["disk"])
+	})
+
+	t.Run("spread", func(t *testing.T) {
+		scheduler := NewScheduler(proxy, 1, rmbClient)
+		err := scheduler.ProcessRequests(context.Background(), []Request{
+			{Name: "web", SpreadGroup: "s"},
+			{Name: "vm", AffinityGroup: "g"},
+			{Name: "disk", AffinityGroup: "g", SpreadGroup: "s"},
+		}, map[string]uint32{"web": 1, "vm": 1})
+		assert.Error(t, err)
+	})
+}
+
+func TestPublicIPsAcrossFarms(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	rmbClient := &RMBClientMock{
+		hasFarmerBot: false,
+	}
+	proxy.AddNode(1, proxyTypes.Node{NodeID: 1, FarmID: 1})
+	proxy.AddNode(2, proxyTypes.Node{NodeID: 2, FarmID: 2})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 1,
+		PublicIps: []proxyTypes.PublicIP{
+			{IP: "1.1.1.1"},
+			{IP: "1.1.1.2"},
+			{IP: "1.1.1.3", ContractID: 10},
+		},
+	})
+	proxy.AddFarm(proxyTypes.Farm{
+		FarmID: 2,
+		PublicIps: []proxyTypes.PublicIP{
+			{IP: "2.2.2.1"},
+		},
+	})
+	farmOf := map[uint32]uint32{1: 1, 2: 2}
+
+	tests := []struct {
+		name string
+		reqs []Request
+		// ipsPerFarm is the expected count of public ips assigned on each farm
+		ipsPerFarm map[uint32]uint32
+		fails      bool
+	}{
+		{
+			name: "all-free-ips",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 1},
+				{Name: "r2", PublicIpsCount: 1},
+				{Name: "r3", PublicIpsCount: 1},
+			},
+			ipsPerFarm: map[uint32]uint32{1: 2, 2: 1},
+		},
+		{
+			name: "more-than-free-ips",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 1},
+				{Name: "r2", PublicIpsCount: 1},
+				{Name: "r3", PublicIpsCount: 1},
+				{Name: "r4", PublicIpsCount: 1},
+			},
+			fails: true,
+		},
+		{
+			name: "multiple-ips-request",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 2},
+				{Name: "r2", PublicIpsCount: 1},
+			},
+			ipsPerFarm: map[uint32]uint32{1: 2, 2: 1},
+		},
+		{
+			name: "multiple-ips-requests-exceeding-farms",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 2},
+				{Name: "r2", PublicIpsCount: 2},
+			},
+			fails: true,
+		},
+		{
+			name: "farm-without-enough-ips",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 2, FarmId: 2},
+			},
+			fails: true,
+		},
+		{
+			name: "farm-ips-consumed-by-other-request",
+			reqs: []Request{
+				{Name: "r1", PublicIpsCount: 1, FarmId: 2},
+				{Name: "r2", PublicIpsCount: 1, FarmId: 2},
+			},
+			fails: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scheduler := NewScheduler(proxy, 1, rmbClient)
+			assignment := map[string]uint32{}
+			err := scheduler.ProcessRequests(context.Background(), tc.reqs, assignment)
+			if tc.fails {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			ipsPerFarm := map[uint32]uint32{}
+			for _, r := range tc.reqs {
+				ipsPerFarm[farmOf[assignment[r.Name]]] += r.PublicIpsCount
+			}
+			assert.Equal(t, tc.ipsPerFarm, ipsPerFarm)
+		})
+	}
+}
+
+func TestRentedNodes(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	proxy.AddFarm(proxyTypes.Farm{FarmID: 1})
+	for id := 1; id <= 20; id++ {
+		node := proxyTypes.Node{NodeID: id, FarmID: 1, Dedicated: true}
+		if id == 15 {
+			node.RentedByTwinID = 1
+		}
+		if id == 16 {
+			node.RentedByTwinID = 2
+		}
+		proxy.AddNode(uint32(id), node)
+	}
+
+	for _, r := range []Request{
+		{Name: "rented-by-me", RentedByMe: true},
+		{Name: "prefer-rented", PreferRented: true, Strategy: SpreadStrategy{}},
+		{Name: "prefer-rented-dedicated", PreferRented: true, Dedicated: true},
+	} {
+		scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+		scheduler.SetFetcherOptions(FetcherOptions{PageSize: 5, Concurrency: 1})
+		node, err := scheduler.Schedule(context.Background(), &r)
+		assert.NoError(t, err, r.Name)
+		assert.Equal(t, node, uint32(15), r.Name)
+	}
+
+	scheduler := NewScheduler(proxy, 2, &RMBClientMock{})
+	node, err := scheduler.Schedule(context.Background(), &Request{Name: "other-twin", RentedByMe: true})
+	assert.NoError(t, err)
+	assert.Equal(t, node, uint32(16), "only the node rented by twin 2 should be used")
+
+	scheduler = NewScheduler(proxy, 3, &RMBClientMock{})
+	_, err = scheduler.Schedule(context.Background(), &Request{Name: "no-rented-nodes", RentedByMe: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+const (
+	// SpreadByNode spreads the requests of a group on different nodes
+	SpreadByNode = "node"
+	// SpreadByFarm spreads the requests of a group on different farms
+	SpreadByFarm = "farm"
+	// SpreadByCountry spreads the requests of a group on different countries
+	SpreadByCountry = "country"
+)
+
+// SpreadBy is a list of the supported spread topologies
+var SpreadBy = []string{SpreadByNode, SpreadByFarm, SpreadByCountry}
+
+// spreadGroups holds the nodes assigned to the requests of each spread group
+type spreadGroups map[string][]proxyTypes.Node
+
+func validateSpread(r *Request) error {
+	if r.SpreadGroup == "" {
+		return nil
+	}
+	if !contains(SpreadBy, r.spreadBy()) {
+		return fmt.Errorf("unknown spread_by %s of request %s, supported values are %v", r.SpreadBy, r.Name, SpreadBy)
+	}
+	return nil
+}
+
+// spreadKey returns the topology domain of a node according to the given spread
+func spreadKey(node *proxyTypes.Node, spreadBy string) string {
+	switch spreadBy {
+	case SpreadByFarm:
+		return strconv.Itoa(node.FarmID)
+	case SpreadByCountry:
+		return strings.ToLower(node.Country)
+	default:
+		return strconv.Itoa(node.NodeID)
+	}
+}
+
+// usedKeys returns the topology domains already used by the request's spread group
+func (g spreadGroups) usedKeys(r *Request) []string {
+	keys := []string{}
+	for idx := range g[r.SpreadGroup] {
+		key := spreadKey(&g[r.SpreadGroup][idx], r.spreadBy())
+		if !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (g spreadGroups) add(group string, node proxyTypes.Node) {
+	if group == "" {
+		return
+	}
+	g[group] = append(g[group], node)
+}
+
+// getNodeDetails returns the node from the scheduler's cache, or from the grid proxy if it wasn't listed before
+func (n *Scheduler) getNodeDetails(nodeID uint32) (proxyTypes.Node, error) {
+	if node, ok := n.nodes[nodeID]; ok {
+		return node.Node, nil
+	}
+	node, err := n.gridProxyClient.Node(nodeID)
+	if err != nil {
+		return proxyTypes.Node{}, errors.Wrapf(err, "couldn't get node %d", nodeID)
+	}
+	return proxyTypes.Node{
+		ID:                node.ID,
+		NodeID:            node.NodeID,
+		FarmID:            node.FarmID,
+		TwinID:            node.TwinID,
+		Country:           node.Country,
+		City:              node.City,
+		TotalResources:    node.Capacity.Total,
+		UsedResources:     node.Capacity.Used,
+		Location:          node.Location,
+		PublicConfig:      node.PublicConfig,
+		Status:            node.Status,
+		CertificationType: node.CertificationType,
+		Dedicated:         node.Dedicated,
+		RentContractID:    node.RentContractID,
+		RentedByTwinID:    node.RentedByTwinID,
+		Power:             node.Power,
+	}, nil
+}
@@ -0,0 +1,145 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+const (
+	// StrategyRandom picks a random eligible node
+	StrategyRandom = "random"
+	// StrategyBinPack picks the most used eligible node first
+	StrategyBinPack = "binpack"
+	// StrategySpread picks the least used eligible node first
+	StrategySpread = "spread"
+	// StrategySeededRandom picks a random eligible node, reproducible for the same seed
+	StrategySeededRandom = "seeded-random"
+	// StrategyCheapest picks the eligible node with the lowest estimated cost first
+	StrategyCheapest = "cheapest"
+)
+
+// Strategies is a list of the built-in strategies names
+var Strategies = []string{StrategyRandom, StrategyBinPack, StrategySpread, StrategySeededRandom, StrategyCheapest}
+
+// Candidate is a node considered by a strategy
+type Candidate struct {
+	Node         proxyTypes.Node
+	FreeCapacity Capacity
+	// Cost is the estimated monthly cost in USD of the request on the node
+	Cost float64
+}
+
+// Strategy orders candidate nodes by preference, a request is assigned to the first candidate that satisfies it
+type Strategy interface {
+	Order(candidates []Candidate)
+}
+
+// RandomStrategy shuffles the candidates
+type RandomStrategy struct{}
+
+// BinPackStrategy orders the candidates from the most used to the least used
+type BinPackStrategy struct{}
+
+// SpreadStrategy orders the candidates from the least used to the most used
+type SpreadStrategy struct{}
+
+// CheapestStrategy orders the candidates from the cheapest to the most expensive
+type CheapestStrategy struct{}
+
+// SeededRandomStrategy shuffles the candidates using a fixed seed
+type SeededRandomStrategy struct {
+	Seed int64
+}
+
+// NewStrategy returns the built-in strategy with the given name,
+// the seed is only used by the seeded-random strategy, and defaults to a hash of the request name if zero
+func NewStrategy(name string, seed int64, requestName string) (Strategy, error) {
+	switch name {
+	case StrategyRandom, "":
+		return RandomStrategy{}, nil
+	case StrategyBinPack:
+		return BinPackStrategy{}, nil
+	case StrategySpread:
+		return SpreadStrategy{}, nil
+	case StrategyCheapest:
+		return CheapestStrategy{}, nil
+	case StrategySeededRandom:
+		if seed == 0 {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(requestName))
+			seed = int64(h.Sum64())
+		}
+		return SeededRandomStrategy{Seed: seed}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %s, supported strategies are %v", name, Strategies)
+	}
+}
+
+// Order shuffles the candidates
+func (s RandomStrategy) Order(candidates []Candidate) {
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+}
+
+// Order sorts the candidates from the most used to the least used
+func (s BinPackStrategy) Order(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return usage(&candidates[i]) > usage(&candidates[j])
+	})
+}
+
+// Order sorts the candidates from the least used to the most used
+func (s SpreadStrategy) Order(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return usage(&candidates[i]) < usage(&candidates[j])
+	})
+}
+
+// Order sorts the candidates from the cheapest to the most expensive
+func (s CheapestStrategy) Order(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Cost < candidates[j].Cost
+	})
+}
+
+// Order shuffles the candidates deterministically using the strategy seed
+func (s SeededRandomStrategy) Order(candidates []Candidate) {
+	r := rand.New(rand.NewSource(s.Seed))
+	r.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+}
+
+// usage is the average used fraction of the candidate's resources
+func usage(c *Candidate) float64 {
+	total := c.Node.TotalResources
+	resources := []struct {
+		total uint64
+		free  uint64
+	}{
+		{uint64(total.MRU), c.FreeCapacity.MRU},
+		{uint64(total.SRU), c.FreeCapacity.SRU},
+		{uint64(total.HRU), c.FreeCapacity.HRU},
+		{total.CRU, c.FreeCapacity.CRU},
+	}
+
+	var sum float64
+	var count int
+	for _, r := range resources {
+		if r.total == 0 {
+			continue
+		}
+		used := r.total - r.free
+		if r.free > r.total {
+			used = 0
+		}
+		sum += float64(used) / float64(r.total)
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
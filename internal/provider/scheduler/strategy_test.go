@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+	"github.com/threefoldtech/zos/pkg/gridtypes"
+)
+
+func candidatesWithUsage() []Candidate {
+	used := []uint64{5, 9, 1}
+	candidates := make([]Candidate, 0, len(used))
+	for idx, u := range used {
+		n := proxyTypes.Node{
+			NodeID: idx + 1,
+			TotalResources: proxyTypes.Capacity{
+				MRU: 10,
+				CRU: 10,
+			},
+			UsedResources: proxyTypes.Capacity{
+				MRU: gridtypes.Unit(u),
+				CRU: u,
+			},
+		}
+		candidates = append(candidates, Candidate{
+			Node:         n,
+			FreeCapacity: freeCapacity(&n),
+		})
+	}
+	return candidates
+}
+
+func candidateIDs(candidates []Candidate) []int {
+	ids := make([]int, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.Node.NodeID)
+	}
+	return ids
+}
+
+func TestBinPackStrategy(t *testing.T) {
+	candidates := candidatesWithUsage()
+	BinPackStrategy{}.Order(candidates)
+	assert.Equal(t, candidateIDs(candidates), []int{2, 1, 3})
+}
+
+func TestSpreadStrategy(t *testing.T) {
+	candidates := candidatesWithUsage()
+	SpreadStrategy{}.Order(candidates)
+	assert.Equal(t, candidateIDs(candidates), []int{3, 1, 2})
+}
+
+func TestSeededRandomStrategy(t *testing.T) {
+	first := candidatesWithUsage()
+	SeededRandomStrategy{Seed: 42}.Order(first)
+	for i := 0; i < 10; i++ {
+		candidates := candidatesWithUsage()
+		SeededRandomStrategy{Seed: 42}.Order(candidates)
+		assert.Equal(t, candidateIDs(first), candidateIDs(candidates), "same seed should give the same order")
+	}
+}
+
+func TestNewStrategy(t *testing.T) {
+	for _, name := range Strategies {
+		_, err := NewStrategy(name, 0, "req")
+		assert.NoError(t, err, name)
+	}
+	_, err := NewStrategy("cheapest-ever", 0, "req")
+	assert.Error(t, err)
+
+	s1, err := NewStrategy(StrategySeededRandom, 0, "req")
+	assert.NoError(t, err)
+	s2, err := NewStrategy(StrategySeededRandom, 0, "req")
+	assert.NoError(t, err)
+	assert.Equal(t, s1, s2, "default seed should be derived from the request name")
+}
@@ -0,0 +1,60 @@
+// Package scheduler provides a simple scheduler interface to request deployments on nodes.
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+// IneligibleError is returned by Verify if the node assigned to a request doesn't satisfy it anymore,
+// as opposed to errors failing to get the node
+type IneligibleError struct {
+	NodeID uint32
+	Reason string
+}
+
+func (e *IneligibleError) Error() string {
+	return fmt.Sprintf("node %d %s", e.NodeID, e.Reason)
+}
+
+// Verify checks that the node assigned to the request is still up, still available for the scheduler's twin,
+// and still has the capacity required by the request. The node's total capacity is checked rather than its
+// free capacity, as the request's own workloads could already be deployed on it. An IneligibleError is returned
+// if the node doesn't satisfy the request anymore.
+func (n *Scheduler) Verify(nodeID uint32, r *Request) error {
+	id := uint64(nodeID)
+	nodes, _, err := n.gridProxyClient.Nodes(proxyTypes.NodeFilter{
+		NodeID:       &id,
+		AvailableFor: &n.twinID,
+	}, proxyTypes.Limit{
+		Size: 1,
+		Page: 1,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "couldn't get node %d from the grid proxy", nodeID)
+	}
+	if len(nodes) == 0 {
+		return &IneligibleError{NodeID: nodeID, Reason: fmt.Sprintf("is not available for twin %d anymore", n.twinID)}
+	}
+
+	node := nodes[0]
+	if node.Status != statusUP {
+		return &IneligibleError{NodeID: nodeID, Reason: fmt.Sprintf("is %s", node.Status)}
+	}
+
+	total := Capacity{
+		MRU: uint64(node.TotalResources.MRU),
+		SRU: uint64(node.TotalResources.SRU),
+		HRU: uint64(node.TotalResources.HRU),
+		CRU: node.TotalResources.CRU,
+	}
+	if r.Capacity.MRU > total.MRU ||
+		r.Capacity.SRU > total.SRU ||
+		r.Capacity.HRU > total.HRU ||
+		r.Capacity.CRU > total.CRU {
+		return &IneligibleError{NodeID: nodeID, Reason: fmt.Sprintf("doesn't have the capacity required by request %s anymore", r.Name)}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	proxyTypes "github.com/threefoldtech/tfgrid-sdk-go/grid-proxy/pkg/types"
+)
+
+func TestVerify(t *testing.T) {
+	proxy := &GridProxyClientMock{}
+	nodes := []proxyTypes.Node{
+		{NodeID: 1, Status: "up", TotalResources: proxyTypes.Capacity{MRU: 10, CRU: 4}},
+		{NodeID: 2, Status: "down", TotalResources: proxyTypes.Capacity{MRU: 10, CRU: 4}},
+		{NodeID: 3, Status: "up", RentedByTwinID: 5, TotalResources: proxyTypes.Capacity{MRU: 10, CRU: 4}},
+		{NodeID: 4, Status: "up", RentedByTwinID: 1, TotalResources: proxyTypes.Capacity{MRU: 10, CRU: 4}},
+		{NodeID: 5, Status: "up", TotalResources: proxyTypes.Capacity{MRU: 10, CRU: 2}},
+	}
+	for _, node := range nodes {
+		proxy.AddNode(uint32(node.NodeID), node)
+	}
+	scheduler := NewScheduler(proxy, 1, &RMBClientMock{})
+	r := Request{Name: "req", Capacity: Capacity{MRU: 5, CRU: 3}}
+
+	var ineligible *IneligibleError
+	assert.NoError(t, scheduler.Verify(1, &r), "node is up")
+	assert.ErrorAs(t, scheduler.Verify(2, &r), &ineligible, "node is down")
+	assert.ErrorAs(t, scheduler.Verify(3, &r), &ineligible, "node is rented by another twin")
+	assert.NoError(t, scheduler.Verify(4, &r), "node is rented by the scheduler's twin")
+	assert.ErrorAs(t, scheduler.Verify(5, &r), &ineligible, "node doesn't have enough cpus")
+	assert.ErrorAs(t, scheduler.Verify(6, &r), &ineligible, "node doesn't exist")
+}
+
+func TestVerifyProxyFailure(t *testing.T) {
+	scheduler := NewScheduler(&failingProxy{}, 1, &RMBClientMock{})
+	err := scheduler.Verify(1, &Request{Name: "req"})
+	assert.Error(t, err)
+	var ineligible *IneligibleError
+	assert.False(t, errors.As(err, &ineligible), "a proxy failure doesn't make the node ineligible")
+}
+
+// failingProxy fails every nodes listing
+type failingProxy struct {
+	GridProxyClientMock
+}
+
+func (p *failingProxy) Nodes(filter proxyTypes.NodeFilter, limit proxyTypes.Limit) ([]proxyTypes.Node, int, error) {
+	return nil, 0, errors.New("grid proxy is unreachable")
+}
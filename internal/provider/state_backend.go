@@ -0,0 +1,136 @@
+// Package provider is the terraform provider
+package provider
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/pkg/errors"
+	"github.com/threefoldtech/terraform-provider-grid/internal/state"
+)
+
+const (
+	stateBackendLocal = "local"
+	stateBackendS3    = "s3"
+	stateBackendHTTP  = "http"
+)
+
+func stateBackendSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "backend storing the provider's state, e.g. for runs on ephemeral machines, defaults to the local state file",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"type": {
+					Type:         schema.TypeString,
+					Required:     true,
+					Description:  "backend type, one of: local s3 http. The local backend uses `state_path`",
+					ValidateFunc: validation.StringInSlice([]string{stateBackendLocal, stateBackendS3, stateBackendHTTP}, false),
+				},
+				"endpoint": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "s3: url of an S3-compatible object storage, example: https://minio.example.com, defaults to the AWS endpoint of the region",
+				},
+				"region": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Default:     "us-east-1",
+					Description: "s3: region of the bucket",
+				},
+				"bucket": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "s3: bucket of the state object",
+				},
+				"key": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "s3: key of the state object, defaults to terraform-provider-grid/<workspace>-<configuration hash>.json like the local state file",
+				},
+				"access_key": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "s3: access key, defaults to the AWS credentials of the environment",
+				},
+				"secret_key": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "s3: secret key, defaults to the AWS credentials of the environment",
+				},
+				"address": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "http: url of the state, it's read with GET and written with PUT, and the server should support ETag conditional requests for locking. The url is used as is by all workspaces, so each workspace and configuration should use its own url",
+				},
+				"username": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "http: username for basic auth",
+				},
+				"password": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Sensitive:   true,
+					Description: "http: password for basic auth",
+				},
+			},
+		},
+	}
+}
+
+// stateBackend creates the configured state backend
+func stateBackend(d *schema.ResourceData) (state.Backend, error) {
+	backendType := stateBackendLocal
+	cfg := map[string]interface{}{}
+	if blocks := d.Get("state_backend").([]interface{}); len(blocks) != 0 && blocks[0] != nil {
+		cfg = blocks[0].(map[string]interface{})
+		backendType = cfg["type"].(string)
+	}
+	get := func(key string) string {
+		value, _ := cfg[key].(string)
+		return value
+	}
+
+	switch backendType {
+	case stateBackendLocal:
+		path := d.Get("state_path").(string)
+		if path == "" {
+			var err error
+			path, err = state.DefaultPath()
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't resolve local state path")
+			}
+		}
+		return state.NewLocalBackend(path), nil
+	case stateBackendS3:
+		if get("bucket") == "" {
+			return nil, errors.New("state backend s3 requires a bucket")
+		}
+		key := get("key")
+		if key == "" {
+			defaultKey, err := state.DefaultKey()
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't resolve s3 state key")
+			}
+			key = "terraform-provider-grid/" + defaultKey
+		}
+		return state.NewS3Backend(state.S3Config{
+			Endpoint:  get("endpoint"),
+			Region:    get("region"),
+			Bucket:    get("bucket"),
+			Key:       key,
+			AccessKey: get("access_key"),
+			SecretKey: get("secret_key"),
+		})
+	case stateBackendHTTP:
+		if get("address") == "" {
+			return nil, errors.New("state backend http requires an address")
+		}
+		return state.NewHTTPBackend(get("address"), get("username"), get("password")), nil
+	}
+	return nil, errors.Errorf("unknown state backend type %s", backendType)
+}
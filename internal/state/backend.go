@@ -0,0 +1,31 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// ErrConflict is returned by a backend write if the stored state changed since it was read
+var ErrConflict = errors.New("state was changed by another process")
+
+// Backend stores the content of the provider's state
+type Backend interface {
+	// Read returns the stored content and its version, the content is empty if nothing is stored yet
+	Read(ctx context.Context) (content []byte, version string, err error)
+	// Write stores the content if the stored version is still the given one, otherwise it returns ErrConflict.
+	// An empty version only matches if nothing is stored yet. It returns the version of the stored content.
+	Write(ctx context.Context, content []byte, version string) (string, error)
+}
+
+// contentVersion is the version of content stored by backends without native versions
+func contentVersion(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
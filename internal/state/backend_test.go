@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// objectStore is an http stand-in for an object storage, it supports conditional puts on the objects' ETags
+type objectStore struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	versions map[string]int
+	username string
+	password string
+}
+
+func newObjectStore(t *testing.T) (*objectStore, *httptest.Server) {
+	store := &objectStore{objects: map[string][]byte{}, versions: map[string]int{}}
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+	return store, server
+}
+
+func (s *objectStore) etag(path string) string {
+	return strconv.Quote(strconv.Itoa(s.versions[path]))
+}
+
+func (s *objectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.username != "" {
+		if username, password, ok := r.BasicAuth(); !ok || username != s.username || password != s.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := r.URL.Path
+	content, exists := s.objects[path]
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", s.etag(path))
+		_, _ = w.Write(content)
+	case http.MethodPut:
+		if match := r.Header.Get("If-Match"); match != "" && (!exists || match != s.etag(path)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.objects[path] = body
+		s.versions[path]++
+		w.Header().Set("ETag", s.etag(path))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	_, server := newObjectStore(t)
+	s3Backend, err := NewS3Backend(S3Config{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "bucket",
+		Key:       "grid/default.json",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	assert.NoError(t, err)
+
+	backends := map[string]Backend{
+		"local": NewLocalBackend(filepath.Join(t.TempDir(), "state.json")),
+		"http":  NewHTTPBackend(server.URL+"/states/default", "", ""),
+		"s3":    s3Backend,
+	}
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			content, version, err := backend.Read(ctx)
+			assert.NoError(t, err)
+			assert.Empty(t, content)
+			assert.Empty(t, version)
+
+			first, err := backend.Write(ctx, []byte(`{"networks":{}}`), "")
+			assert.NoError(t, err)
+			assert.NotEmpty(t, first)
+			_, err = backend.Write(ctx, []byte(`{"networks":{"other":{}}}`), "")
+			assert.ErrorIs(t, err, ErrConflict)
+
+			second, err := backend.Write(ctx, []byte(`{"networks":{"net":{}}}`), first)
+			assert.NoError(t, err)
+			_, err = backend.Write(ctx, []byte(`{"networks":{"other":{}}}`), first)
+			assert.ErrorIs(t, err, ErrConflict)
+
+			content, version, err = backend.Read(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, `{"networks":{"net":{}}}`, string(content))
+			assert.Equal(t, second, version)
+		})
+	}
+}
+
+func TestHTTPBackendAuth(t *testing.T) {
+	store, server := newObjectStore(t)
+	store.username, store.password = "user", "pass"
+
+	_, _, err := NewHTTPBackend(server.URL, "user", "wrong").Read(context.Background())
+	assert.Error(t, err)
+	_, _, err = NewHTTPBackend(server.URL, "user", "pass").Read(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestHTTPBackendConcurrentProcesses(t *testing.T) {
+	_, server := newObjectStore(t)
+	const processes = 5
+
+	var loaded sync.WaitGroup
+	loaded.Add(processes)
+	save := make(chan struct{})
+	errs := make(chan error, processes)
+	for i := 0; i < processes; i++ {
+		go func(i int) {
+			st := NewLocalFileState()
+			err := st.Open(context.Background(), NewHTTPBackend(server.URL, "", ""))
+			loaded.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+			<-save
+			st.GetState().Networks.GetNetwork(fmt.Sprintf("net%d", i))
+			errs <- st.Save(context.Background())
+		}(i)
+	}
+	loaded.Wait()
+	close(save)
+	for i := 0; i < processes; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	st := NewLocalFileState()
+	assert.NoError(t, st.Open(context.Background(), NewHTTPBackend(server.URL, "", "")))
+	assert.Len(t, st.GetState().Networks, processes)
+}
@@ -2,11 +2,14 @@
 package state
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 	"reflect"
 
 	"github.com/pkg/errors"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
 )
 
 // Getter interface for local state
@@ -16,13 +19,51 @@ type Getter interface {
 }
 
 const (
-	// FileName is a static file name for state that is generated beside the .tf file
+	// FileName is the legacy static file name for state that was generated beside the .tf file,
+	// it's migrated to the workspace's state path on load
 	FileName = "state.json"
 )
 
-// LocalFileState struct is the local state file
+// maxSaveAttempts bounds the attempts to save the state while other processes keep changing it
+const maxSaveAttempts = 20
+
+// Loader interface for a state loaded once its backend is known
+type Loader interface {
+	Getter
+	// Open loads the state from the given backend, it's saved back to it later
+	Open(ctx context.Context, backend Backend) error
+}
+
+// LocalFileState struct is the provider's state, stored in a local file unless opened with another backend
 type LocalFileState struct {
-	st State
+	st      State
+	backend Backend
+	// loaded is the state as it was loaded, to only save the networks changed by this process
+	loaded State
+	// stored is the state stored in the backend when it was last read, and version is its version
+	stored  State
+	version string
+	// readOnly is set if the stored state was written by a newer version of the provider, so it's not overwritten
+	readOnly bool
+}
+
+// RecoveryError is returned by Open if the stored state couldn't be read. The state is usable but starts empty,
+// the networks are rebuilt from the deployments on the grid instead.
+type RecoveryError struct {
+	Err error
+	// ReadOnly is set if the stored state isn't overwritten on save
+	ReadOnly bool
+}
+
+func (e *RecoveryError) Error() string {
+	if e.ReadOnly {
+		return "couldn't read the stored state, an empty state is used and won't be saved: " + e.Err.Error()
+	}
+	return "couldn't read the stored state, an empty state is used and will replace it: " + e.Err.Error()
+}
+
+func (e *RecoveryError) Unwrap() error {
+	return e.Err
 }
 
 // NewLocalFileState generates a new local state
@@ -31,53 +72,196 @@ func NewLocalFileState() LocalFileState {
 
 }
 
-// Load loads state from state.json file
-func (f *LocalFileState) Load(FileName string) error {
-	// os.OpenFile(FileName, os.O_CREATE, 0644)
+// Load loads state from the given file, and the legacy state.json file is migrated to it if it exists
+func (f *LocalFileState) Load(path string) error {
+	return f.Open(context.Background(), NewLocalBackend(path))
+}
+
+// Open loads state from the given backend, upgrading it to the current version.
+// If the stored state can't be read, an empty state is used and a RecoveryError is returned.
+func (f *LocalFileState) Open(ctx context.Context, backend Backend) error {
 	f.st = State{}
-	_, err := os.Stat(FileName)
-	if err != nil && os.IsNotExist(err) {
-		_, err = os.OpenFile(FileName, os.O_CREATE, 0644)
-		if err != nil {
-			return err
-		}
-		return nil
+	f.loaded = State{}
+	f.backend = backend
+	content, err := f.read(ctx)
+	var recovery *RecoveryError
+	if errors.As(err, &recovery) {
+		return recovery
 	}
-	content, err := os.ReadFile(FileName)
 	if err != nil {
 		return err
 	}
+	// parsed again for copies not shared with the stored state
+	f.st, _ = parseState(content)
+	f.loaded, _ = parseState(content)
+	return nil
+}
 
-	err = json.Unmarshal(content, &f.st)
-	if err != nil {
-		return err
+// Opened returns true if the state was loaded from a backend
+func (f *LocalFileState) Opened() bool {
+	return f.backend != nil
+}
+
+// Path returns the path the state was loaded from, it's empty if the state wasn't loaded from a local file
+func (f *LocalFileState) Path() string {
+	if local, ok := f.backend.(*LocalBackend); ok {
+		return local.Path()
 	}
-	return nil
+	return ""
 }
 
 // GetState returns the current state
 func (f *LocalFileState) GetState() State {
-	if reflect.DeepEqual(f.st, State{}) {
-		state := NewState()
-		f.st = state
-	}
+	f.st.GetNetworkState()
 	return f.st
 }
 
-// Save saves the state to the state,json file
-func (f *LocalFileState) Save(FileName string) error {
-	if content, err := json.Marshal(f.st); err == nil {
-		err = os.WriteFile(FileName, content, 0644)
+// Save saves the state to its backend. The networks changed by other processes since the state was loaded are kept,
+// and the save is retried with them if the stored state changes while saving.
+func (f *LocalFileState) Save(ctx context.Context) error {
+	if f.backend == nil {
+		return errors.New("failed to save state: state wasn't loaded")
+	}
+	if f.readOnly {
+		return nil
+	}
+	f.st.Version = CurrentVersion
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		f.st.Networks = mergeNetworks(f.loaded.Networks, f.GetState().Networks, f.stored.Networks)
+		content, err := json.Marshal(f.st)
+		if err != nil {
+			return errors.Wrap(err, "failed to save state")
+		}
+		version, err := f.backend.Write(ctx, content, f.version)
+		if errors.Is(err, ErrConflict) {
+			// an unreadable stored state is replaced, unless it was written by a newer version
+			var recovery *RecoveryError
+			if _, err := f.read(ctx); err != nil && !errors.As(err, &recovery) {
+				return err
+			}
+			if f.readOnly {
+				return nil
+			}
+			continue
+		}
 		if err != nil {
-			return errors.Wrapf(err, "failed to write file: %s", FileName)
+			return errors.Wrap(err, "failed to save state")
 		}
-	} else {
-		return errors.Wrapf(err, "failed to save file: %s", FileName)
+		f.version = version
+		f.stored, _ = parseState(content)
+		f.loaded, _ = parseState(content)
+		return nil
 	}
-	return nil
+	return errors.Errorf("failed to save state: it kept changing during %d attempts", maxSaveAttempts)
+}
+
+// read reads the stored state and its version, the stored state is empty if it couldn't be parsed
+func (f *LocalFileState) read(ctx context.Context) ([]byte, error) {
+	content, version, err := f.backend.Read(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read state")
+	}
+	f.version = version
+	f.stored, err = parseState(content)
+	f.readOnly = errors.Is(err, ErrNewerVersion)
+	if err != nil {
+		return nil, &RecoveryError{Err: err, ReadOnly: f.readOnly}
+	}
+	return content, nil
 }
 
 // Delete deletes state,json file
 func (f *LocalFileState) Delete(FileName string) error {
 	return os.Remove(FileName)
 }
+
+// mergeNetworks applies the changes made since loaded to the stored networks. Changes are merged per node subnet
+// and per deployment host ids, so that processes changing different nodes or deployments of a network keep each other's changes.
+func mergeNetworks(loaded, current, stored state.NetworkState) state.NetworkState {
+	merged := state.NetworkState{}
+	for name, network := range stored {
+		merged[name] = copyNetwork(network)
+	}
+	changed := map[string]bool{}
+	for name := range loaded {
+		changed[name] = true
+	}
+	for name := range current {
+		changed[name] = true
+	}
+	for name := range changed {
+		before, wasLoaded := loaded[name]
+		after, exists := current[name]
+		if wasLoaded == exists && reflect.DeepEqual(before, after) {
+			continue
+		}
+		network, ok := merged[name]
+		if !ok {
+			if !exists {
+				continue
+			}
+			network = state.NewNetwork()
+		}
+		mergeSubnets(before.Subnets, after.Subnets, network.Subnets)
+		mergeHostIDs(before.NodeDeploymentHostIDs, after.NodeDeploymentHostIDs, network.NodeDeploymentHostIDs)
+		// a network deleted by this process is kept if other processes still use it
+		if !exists && len(network.Subnets) == 0 && len(network.NodeDeploymentHostIDs) == 0 {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = network
+	}
+	return merged
+}
+
+// mergeSubnets applies the node subnets changed since loaded to the merged ones
+func mergeSubnets(loaded, current, merged map[uint32]string) {
+	for nodeID, subnet := range current {
+		if before, ok := loaded[nodeID]; !ok || before != subnet {
+			merged[nodeID] = subnet
+		}
+	}
+	for nodeID := range loaded {
+		if _, ok := current[nodeID]; !ok {
+			delete(merged, nodeID)
+		}
+	}
+}
+
+// mergeHostIDs applies the deployments' host ids changed since loaded to the merged ones
+func mergeHostIDs(loaded, current, merged state.NodeDeploymentHostIDs) {
+	for nodeID, deployments := range current {
+		for contractID, ids := range deployments {
+			if before, ok := loaded[nodeID][contractID]; !ok || !bytes.Equal(before, ids) {
+				if merged[nodeID] == nil {
+					merged[nodeID] = state.DeploymentHostIDs{}
+				}
+				merged[nodeID][contractID] = ids
+			}
+		}
+	}
+	for nodeID, deployments := range loaded {
+		for contractID := range deployments {
+			if _, ok := current[nodeID][contractID]; !ok {
+				delete(merged[nodeID], contractID)
+			}
+		}
+		if len(merged[nodeID]) == 0 {
+			delete(merged, nodeID)
+		}
+	}
+}
+
+// copyNetwork returns a copy of the network that doesn't share its maps
+func copyNetwork(network state.Network) state.Network {
+	copied := state.NewNetwork()
+	for nodeID, subnet := range network.Subnets {
+		copied.SetNodeSubnet(nodeID, subnet)
+	}
+	for nodeID, deployments := range network.NodeDeploymentHostIDs {
+		for contractID, ids := range deployments {
+			copied.SetDeploymentHostIDs(nodeID, contractID, ids)
+		}
+	}
+	return copied
+}
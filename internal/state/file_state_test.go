@@ -0,0 +1,252 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
+)
+
+func TestSaveConcurrentProcesses(t *testing.T) {
+	chdir(t)
+	path := filepath.Join(".terraform", "grid", "default.json")
+	const processes = 10
+
+	// every process loads the state before any of them saves, then adds its own network
+	var loaded sync.WaitGroup
+	loaded.Add(processes)
+	save := make(chan struct{})
+	errs := make(chan error, processes)
+	for i := 0; i < processes; i++ {
+		go func(i int) {
+			st := NewLocalFileState()
+			err := st.Load(path)
+			loaded.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+			<-save
+			network := st.GetState().Networks.GetNetwork(fmt.Sprintf("net%d", i))
+			network.SetNodeSubnet(uint32(i), fmt.Sprintf("10.1.%d.0/24", i))
+			errs <- st.Save(context.Background())
+		}(i)
+	}
+	loaded.Wait()
+	close(save)
+	for i := 0; i < processes; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	st := NewLocalFileState()
+	assert.NoError(t, st.Load(path))
+	networks := st.GetState().Networks
+	assert.Len(t, networks, processes)
+	for i := 0; i < processes; i++ {
+		network := networks.GetNetwork(fmt.Sprintf("net%d", i))
+		assert.Equal(t, fmt.Sprintf("10.1.%d.0/24", i), network.GetNodeSubnet(uint32(i)))
+	}
+}
+
+func TestSaveKeepsOtherProcessesChanges(t *testing.T) {
+	chdir(t)
+	path := "state.test.json"
+	initial := NewLocalFileState()
+	assert.NoError(t, initial.Load(path))
+	initial.GetState().Networks.GetNetwork("deleted")
+	initial.GetState().Networks.GetNetwork("kept")
+	assert.NoError(t, initial.Save(context.Background()))
+
+	first := NewLocalFileState()
+	assert.NoError(t, first.Load(path))
+	second := NewLocalFileState()
+	assert.NoError(t, second.Load(path))
+
+	first.GetState().Networks.DeleteNetwork("deleted")
+	assert.NoError(t, first.Save(context.Background()))
+	// the second process didn't change the deleted network, so it doesn't bring it back
+	second.GetState().Networks.GetNetwork("added")
+	assert.NoError(t, second.Save(context.Background()))
+
+	st := NewLocalFileState()
+	assert.NoError(t, st.Load(path))
+	assert.Equal(t, state.NetworkState{
+		"kept":  state.NewNetwork(),
+		"added": state.NewNetwork(),
+	}, st.GetState().Networks)
+}
+
+func TestMergeNetworksSameNetwork(t *testing.T) {
+	network := func(subnets map[uint32]string, hostIDs state.NodeDeploymentHostIDs) state.Network {
+		return state.Network{Subnets: subnets, NodeDeploymentHostIDs: hostIDs}
+	}
+	loaded := state.NetworkState{"net": network(
+		map[uint32]string{1: "10.1.1.0/24", 2: "10.1.2.0/24"},
+		state.NodeDeploymentHostIDs{1: {10: {2}}, 2: {20: {2}}},
+	)}
+	// this process added node 3, and removed the deployment on node 1
+	current := state.NetworkState{"net": network(
+		map[uint32]string{1: "10.1.1.0/24", 2: "10.1.2.0/24", 3: "10.1.3.0/24"},
+		state.NodeDeploymentHostIDs{2: {20: {2}}, 3: {30: {2}}},
+	)}
+	// another process added node 4 and a deployment on node 2, and removed node 1
+	stored := state.NetworkState{"net": network(
+		map[uint32]string{2: "10.1.2.0/24", 4: "10.1.4.0/24"},
+		state.NodeDeploymentHostIDs{1: {10: {2}}, 2: {20: {2}, 21: {3}}, 4: {40: {2}}},
+	)}
+
+	merged := mergeNetworks(loaded, current, stored)
+	assert.Equal(t, state.NetworkState{"net": network(
+		map[uint32]string{2: "10.1.2.0/24", 3: "10.1.3.0/24", 4: "10.1.4.0/24"},
+		state.NodeDeploymentHostIDs{2: {20: {2}, 21: {3}}, 3: {30: {2}}, 4: {40: {2}}},
+	)}, merged)
+	assert.Len(t, stored["net"].Subnets, 2, "the stored networks aren't modified")
+
+	// a network deleted by this process is kept while another process still uses it
+	merged = mergeNetworks(loaded, state.NetworkState{}, stored)
+	assert.Equal(t, state.NetworkState{"net": network(
+		map[uint32]string{4: "10.1.4.0/24"},
+		state.NodeDeploymentHostIDs{2: {21: {3}}, 4: {40: {2}}},
+	)}, merged)
+}
+
+// TestSaveHelperProcess isn't a real test, it's run as a separate process by TestSaveSameNetworkProcesses.
+// It adds its node to the shared network of the state, once all processes loaded it.
+func TestSaveHelperProcess(t *testing.T) {
+	if os.Getenv("STATE_HELPER_PROCESS") != "1" {
+		return
+	}
+	dir := os.Getenv("STATE_HELPER_DIR")
+	node, err := strconv.Atoi(os.Getenv("STATE_HELPER_NODE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewLocalFileState()
+	if err := st.Load(filepath.Join(dir, "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("loaded-%d", node)), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFile(t, filepath.Join(dir, "start"))
+
+	network := st.GetState().Networks.GetNetwork("shared")
+	network.SetNodeSubnet(uint32(node), fmt.Sprintf("10.1.%d.0/24", node))
+	network.SetDeploymentHostIDs(uint32(node), uint64(node), []byte{2})
+	// the first process also removes the deployment loaded by all processes
+	if node == 1 {
+		network.DeleteDeploymentHostIDs(100, 100)
+	}
+	if err := st.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveSameNetworkProcesses(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	initial := NewLocalFileState()
+	assert.NoError(t, initial.Load(path))
+	network := initial.GetState().Networks.GetNetwork("shared")
+	network.SetNodeSubnet(100, "10.1.100.0/24")
+	network.SetDeploymentHostIDs(100, 100, []byte{2})
+	assert.NoError(t, initial.Save(context.Background()))
+
+	const processes = 4
+	cmds := []*exec.Cmd{}
+	for node := 1; node <= processes; node++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSaveHelperProcess$")
+		cmd.Env = append(os.Environ(),
+			"STATE_HELPER_PROCESS=1",
+			"STATE_HELPER_DIR="+dir,
+			fmt.Sprintf("STATE_HELPER_NODE=%d", node),
+		)
+		assert.NoError(t, cmd.Start())
+		cmds = append(cmds, cmd)
+	}
+	// every process loads the state before any of them saves
+	for node := 1; node <= processes; node++ {
+		waitFile(t, filepath.Join(dir, fmt.Sprintf("loaded-%d", node)))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "start"), nil, 0644))
+	for _, cmd := range cmds {
+		assert.NoError(t, cmd.Wait())
+	}
+
+	st := NewLocalFileState()
+	assert.NoError(t, st.Load(path))
+	shared := st.GetState().Networks.GetNetwork("shared")
+	assert.Len(t, shared.Subnets, processes+1)
+	for node := uint32(1); node <= processes; node++ {
+		assert.Equal(t, fmt.Sprintf("10.1.%d.0/24", node), shared.GetNodeSubnet(node))
+		assert.Equal(t, []byte{2}, shared.GetDeploymentHostIDs(node, uint64(node)))
+	}
+	assert.Empty(t, shared.GetDeploymentHostIDs(100, 100), "the removed deployment isn't brought back by the other processes")
+}
+
+// waitFile waits for another process to create the file at the given path
+func waitFile(t *testing.T, path string) {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSaveBackupAndAtomicWrite(t *testing.T) {
+	dir := chdir(t)
+	path := "state.test.json"
+	st := NewLocalFileState()
+	assert.NoError(t, st.Load(path))
+	st.GetState().Networks.GetNetwork("first")
+	assert.NoError(t, st.Save(context.Background()))
+	first, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// a crash mid-write leaves a temporary file behind, but not a corrupted state
+	assert.NoError(t, os.WriteFile(path+".tmp-crashed", []byte(`{"networks":`), 0644))
+	st.GetState().Networks.GetNetwork("second")
+	assert.NoError(t, st.Save(context.Background()))
+
+	backup, err := os.ReadFile(path + ".backup")
+	assert.NoError(t, err)
+	assert.Equal(t, first, backup)
+
+	loaded := NewLocalFileState()
+	assert.NoError(t, loaded.Load(path))
+	assert.Len(t, loaded.GetState().Networks, 2)
+
+	tmps, err := filepath.Glob(filepath.Join(dir, path+".tmp-*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, path+".tmp-crashed")}, tmps)
+}
+
+func TestLoadWaitsForLock(t *testing.T) {
+	chdir(t)
+	path := "state.test.json"
+	timeout := lockTimeout
+	lockTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { lockTimeout = timeout })
+
+	lock, err := lockFile(path)
+	assert.NoError(t, err)
+	st := NewLocalFileState()
+	assert.Error(t, st.Load(path))
+
+	// the lock is taken once released by the other process
+	time.AfterFunc(50*time.Millisecond, func() { _ = lock.unlock() })
+	assert.NoError(t, st.Load(path))
+}
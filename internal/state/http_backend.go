@@ -0,0 +1,94 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPBackend stores the state at a url, using ETags for optimistic locking:
+// the state is written with an If-Match header holding the ETag it was read with,
+// or an If-None-Match header if it didn't exist, and the server rejects the write with 412 if it changed since.
+type HTTPBackend struct {
+	address  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewHTTPBackend creates a backend storing the state at the given url, the credentials are used for basic auth if set
+func NewHTTPBackend(address, username, password string) *HTTPBackend {
+	return &HTTPBackend{
+		address:  address,
+		username: username,
+		password: password,
+		client:   http.DefaultClient,
+	}
+}
+
+func (b *HTTPBackend) request(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.address, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request to %s", b.address)
+	}
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	return req, nil
+}
+
+// Read gets the state, a missing state is reported with 404
+func (b *HTTPBackend) Read(ctx context.Context) ([]byte, string, error) {
+	req, err := b.request(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get state from %s", b.address)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, "", errors.Errorf("failed to get state from %s: unexpected status %s", b.address, res.Status)
+	}
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read state from %s", b.address)
+	}
+	return content, res.Header.Get("ETag"), nil
+}
+
+// Write puts the state if its ETag is still the given version
+func (b *HTTPBackend) Write(ctx context.Context, content []byte, version string) (string, error) {
+	req, err := b.request(ctx, http.MethodPut, content)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if version == "" {
+		req.Header.Set("If-None-Match", "*")
+	} else {
+		req.Header.Set("If-Match", version)
+	}
+	res, err := b.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to put state to %s", b.address)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusPreconditionFailed {
+		return "", ErrConflict
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", errors.Errorf("failed to put state to %s: unexpected status %s", b.address, res.Status)
+	}
+	return res.Header.Get("ETag"), nil
+}
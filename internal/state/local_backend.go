@@ -0,0 +1,109 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalBackend stores the state in a local file. The file is locked while it's read or replaced,
+// the previous version is kept as a backup, and the new one is written to a temporary file first,
+// so that a crash mid-write doesn't corrupt the state.
+type LocalBackend struct {
+	path string
+}
+
+// NewLocalBackend creates a backend storing the state in the file at the given path
+func NewLocalBackend(path string) *LocalBackend {
+	return &LocalBackend{path: path}
+}
+
+// Path returns the path of the state file
+func (b *LocalBackend) Path() string {
+	return b.path
+}
+
+// Read reads the state file, migrating the legacy state.json file to it if it doesn't exist
+func (b *LocalBackend) Read(ctx context.Context) ([]byte, string, error) {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to create state directory for %s", b.path)
+	}
+	lock, err := lockFile(b.path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer lock.unlock()
+
+	if err := migrateLegacyState(b.path); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to migrate legacy state to %s", b.path)
+	}
+	content, err := b.read()
+	if err != nil {
+		return nil, "", err
+	}
+	return content, contentVersion(content), nil
+}
+
+// Write replaces the state file if its content didn't change since the given version
+func (b *LocalBackend) Write(ctx context.Context, content []byte, version string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return "", errors.Wrapf(err, "failed to create state directory for %s", b.path)
+	}
+	lock, err := lockFile(b.path)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	previous, err := b.read()
+	if err != nil {
+		return "", err
+	}
+	if contentVersion(previous) != version {
+		return "", ErrConflict
+	}
+	if len(previous) != 0 {
+		if err := writeFileAtomic(b.path+".backup", previous); err != nil {
+			return "", errors.Wrapf(err, "failed to write backup of file: %s", b.path)
+		}
+	}
+	if err := writeFileAtomic(b.path, content); err != nil {
+		return "", errors.Wrapf(err, "failed to write file: %s", b.path)
+	}
+	return contentVersion(content), nil
+}
+
+func (b *LocalBackend) read() ([]byte, error) {
+	content, err := os.ReadFile(b.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to read file: %s", b.path)
+	}
+	return content, nil
+}
+
+// writeFileAtomic writes the content to a temporary file in the same directory, then renames it to the given path
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
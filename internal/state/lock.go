@@ -0,0 +1,56 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// lockTimeout is how long to wait for another process to release the state lock
+	lockTimeout = time.Minute
+	// lockRetryInterval is the interval between attempts to take the state lock
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// fileLock is an advisory lock on a state file, shared by the provider processes using it
+type fileLock struct {
+	file *os.File
+}
+
+// lockFile takes an exclusive lock on the state file at the given path.
+// The lock is taken on a separate lock file, as the state file is replaced on save.
+func lockFile(path string) (*fileLock, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open lock file %s", lockPath)
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "failed to lock %s", lockPath)
+		}
+		if locked {
+			return &fileLock{file: file}, nil
+		}
+		if time.Now().After(deadline) {
+			file.Close()
+			return nil, errors.Errorf("timed out waiting for state lock %s held by another process", lockPath)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return errors.Wrapf(err, "failed to unlock %s", l.file.Name())
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock on the file without blocking, it returns false if it's held by another open file
+func tryLock(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
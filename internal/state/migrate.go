@@ -0,0 +1,69 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// CurrentVersion is the version of the state documents written by the provider
+const CurrentVersion = 1
+
+// ErrNewerVersion is returned for state documents written by a newer version of the provider
+var ErrNewerVersion = errors.New("state was written by a newer version of the provider")
+
+// migration upgrades a state document from a version to the next one
+type migration func(doc map[string]interface{}) error
+
+// migrations holds the migration of each version to the next one, indexed by the version it upgrades.
+// A change to the document's shape, including grid-client's network state, bumps CurrentVersion with a migration here.
+var migrations = []migration{
+	// version 0 is the unversioned document, which has the same shape as version 1
+	func(doc map[string]interface{}) error { return nil },
+}
+
+// upgrade migrates the state document step by step to the current version
+func upgrade(content []byte) ([]byte, error) {
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse state")
+	}
+	version := 0
+	if v, ok := doc["version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f != float64(int(f)) {
+			return nil, errors.Errorf("failed to parse state: invalid version %v", v)
+		}
+		version = int(f)
+	}
+	if version > CurrentVersion {
+		return nil, errors.Wrapf(ErrNewerVersion, "state version %d, supported version %d", version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return content, nil
+	}
+	for ; version < CurrentVersion; version++ {
+		if err := migrations[version](doc); err != nil {
+			return nil, errors.Wrapf(err, "failed to migrate state from version %d", version)
+		}
+		doc["version"] = version + 1
+	}
+	return json.Marshal(doc)
+}
+
+// parseState parses the stored content after upgrading it to the current version, empty content is an empty state
+func parseState(content []byte) (State, error) {
+	s := State{}
+	if len(content) == 0 {
+		return s, nil
+	}
+	upgraded, err := upgrade(content)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(upgraded, &s); err != nil {
+		return State{}, errors.Wrap(err, "failed to parse state")
+	}
+	return s, nil
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	assert.Len(t, migrations, CurrentVersion, "each version needs a migration to the next one")
+}
+
+func TestParseState(t *testing.T) {
+	st, err := parseState([]byte(`{"networks":{"net":{"Subnets":{"1":"10.1.2.0/24"}}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, CurrentVersion, st.Version)
+	network := st.Networks.GetNetwork("net")
+	assert.Equal(t, "10.1.2.0/24", network.GetNodeSubnet(1))
+
+	_, err = parseState([]byte(`{"version":100,"networks":{}}`))
+	assert.True(t, errors.Is(err, ErrNewerVersion))
+
+	_, err = parseState([]byte(`{"networks":`))
+	assert.Error(t, err)
+}
+
+func TestOpenRecoversCorruptedState(t *testing.T) {
+	chdir(t)
+	path := "state.test.json"
+	assert.NoError(t, os.WriteFile(path, []byte(`{"networks":`), 0644))
+
+	st := NewLocalFileState()
+	var recovery *RecoveryError
+	assert.True(t, errors.As(st.Load(path), &recovery))
+	assert.False(t, recovery.ReadOnly)
+	st.GetState().Networks.GetNetwork("net")
+
+	// the corrupted state is replaced with a current one
+	assert.NoError(t, st.Save(context.Background()))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	saved := State{}
+	assert.NoError(t, json.Unmarshal(content, &saved))
+	assert.Equal(t, CurrentVersion, saved.Version)
+	assert.Contains(t, saved.Networks, "net")
+}
+
+func TestOpenKeepsNewerState(t *testing.T) {
+	chdir(t)
+	path := "state.test.json"
+	newer := []byte(`{"version":100,"networks":{"net":{}}}`)
+	assert.NoError(t, os.WriteFile(path, newer, 0644))
+
+	st := NewLocalFileState()
+	var recovery *RecoveryError
+	assert.True(t, errors.As(st.Load(path), &recovery))
+	assert.True(t, recovery.ReadOnly)
+	assert.Empty(t, st.GetState().Networks)
+
+	// the state written by a newer version isn't downgraded
+	st.GetState().Networks.GetNetwork("other")
+	assert.NoError(t, st.Save(context.Background()))
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, newer, content)
+}
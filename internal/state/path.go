@@ -0,0 +1,98 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultDataDir   = ".terraform"
+	defaultWorkspace = "default"
+	// stateDir is the directory in the terraform data directory holding the states of the grid provider
+	stateDir = "grid"
+)
+
+// dataDir returns the terraform data directory, which could be overridden by TF_DATA_DIR
+func dataDir() string {
+	if dir := os.Getenv("TF_DATA_DIR"); dir != "" {
+		return dir
+	}
+	return defaultDataDir
+}
+
+// Workspace returns the current terraform workspace, terraform selects it from TF_WORKSPACE,
+// or from the environment file in its data directory
+func Workspace() string {
+	if workspace := os.Getenv("TF_WORKSPACE"); workspace != "" {
+		return workspace
+	}
+	content, err := os.ReadFile(filepath.Join(dataDir(), "environment"))
+	if err != nil {
+		return defaultWorkspace
+	}
+	if workspace := strings.TrimSpace(string(content)); workspace != "" {
+		return workspace
+	}
+	return defaultWorkspace
+}
+
+// configHash identifies the configuration directory, as the data directory could be shared between configurations
+func configHash(dir string) string {
+	hash := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(hash[:])[:12]
+}
+
+// DefaultKey returns the state name of the current terraform workspace and configuration directory,
+// it's used by the backends storing the states of several workspaces and configurations
+func DefaultKey() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get working directory")
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't get absolute path of %s", dir)
+	}
+	return fmt.Sprintf("%s-%s.json", Workspace(), configHash(dir)), nil
+}
+
+// DefaultPath returns the state path of the current terraform workspace and configuration directory
+func DefaultPath() (string, error) {
+	key, err := DefaultKey()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir(), stateDir, key), nil
+}
+
+// migrateLegacyState moves the legacy state.json file, shared by all workspaces, to the given path if no state exists there.
+// The legacy file is renamed rather than removed, so the first workspace loaded after upgrading takes it over.
+func migrateLegacyState(path string) error {
+	if filepath.Clean(path) == FileName {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	content, err := os.ReadFile(FileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read legacy state file %s", FileName)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create state directory for %s", path)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return errors.Wrapf(err, "couldn't write migrated state file %s", path)
+	}
+	return os.Rename(FileName, FileName+".migrated")
+}
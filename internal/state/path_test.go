@@ -0,0 +1,78 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chdir changes the working directory to a temporary one for the test
+func chdir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	return dir
+}
+
+func TestWorkspace(t *testing.T) {
+	chdir(t)
+	t.Setenv("TF_WORKSPACE", "")
+	t.Setenv("TF_DATA_DIR", "")
+	assert.Equal(t, "default", Workspace())
+
+	assert.NoError(t, os.MkdirAll(".terraform", 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(".terraform", "environment"), []byte("staging\n"), 0644))
+	assert.Equal(t, "staging", Workspace())
+
+	t.Setenv("TF_WORKSPACE", "prod")
+	assert.Equal(t, "prod", Workspace())
+}
+
+func TestDefaultPath(t *testing.T) {
+	chdir(t)
+	t.Setenv("TF_DATA_DIR", "")
+	t.Setenv("TF_WORKSPACE", "staging")
+	staging, err := DefaultPath()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(".terraform", "grid"), filepath.Dir(staging))
+
+	t.Setenv("TF_WORKSPACE", "prod")
+	prod, err := DefaultPath()
+	assert.NoError(t, err)
+	assert.NotEqual(t, staging, prod)
+
+	// configurations sharing a data directory get different states
+	t.Setenv("TF_DATA_DIR", filepath.Join(t.TempDir(), "data"))
+	first, err := DefaultPath()
+	assert.NoError(t, err)
+	chdir(t)
+	second, err := DefaultPath()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestLoadMigratesLegacyState(t *testing.T) {
+	chdir(t)
+	legacy := `{"networks":{"net":{"subnets":{"1":"10.1.2.0/24"}}}}`
+	assert.NoError(t, os.WriteFile(FileName, []byte(legacy), 0644))
+
+	path := filepath.Join(".terraform", "grid", "default.json")
+	st := NewLocalFileState()
+	assert.NoError(t, st.Load(path))
+	assert.Equal(t, path, st.Path())
+	assert.Contains(t, st.GetState().Networks, "net")
+
+	_, err := os.Stat(FileName)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(FileName + ".migrated")
+	assert.NoError(t, err)
+
+	// another workspace doesn't inherit the migrated state
+	other := NewLocalFileState()
+	assert.NoError(t, other.Load(filepath.Join(".terraform", "grid", "other.json")))
+	assert.NotContains(t, other.GetState().Networks, "net")
+}
@@ -0,0 +1,114 @@
+// Package state provides a state to save the user work in a database.
+package state
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// S3Config configures an S3-compatible object storage backend
+type S3Config struct {
+	// Endpoint is the url of the object storage, the AWS endpoint of the region is used if empty
+	Endpoint string
+	Region   string
+	Bucket   string
+	Key      string
+	// AccessKey and SecretKey are the credentials, the default AWS credentials chain is used if empty
+	AccessKey string
+	SecretKey string
+}
+
+// S3Backend stores the state in an object of an S3-compatible object storage,
+// conditional writes on the object's ETag are used for optimistic locking
+type S3Backend struct {
+	client *s3.S3
+	bucket string
+	key    string
+}
+
+// NewS3Backend creates a backend storing the state in the configured object
+func NewS3Backend(cfg S3Config) (*S3Backend, error) {
+	config := aws.NewConfig().WithRegion(cfg.Region)
+	if cfg.Endpoint != "" {
+		// S3-compatible storages, e.g. minio, are usually addressed with the bucket in the path
+		config = config.WithEndpoint(cfg.Endpoint).WithS3ForcePathStyle(true)
+	}
+	if cfg.AccessKey != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, ""))
+	}
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create s3 session")
+	}
+	return &S3Backend{
+		client: s3.New(sess),
+		bucket: cfg.Bucket,
+		key:    cfg.Key,
+	}, nil
+}
+
+// Key returns the key of the state object
+func (b *S3Backend) Key() string {
+	return b.key
+}
+
+// Read gets the state object
+func (b *S3Backend) Read(ctx context.Context) ([]byte, string, error) {
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.key),
+	})
+	if isStatus(err, http.StatusNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get state object %s/%s", b.bucket, b.key)
+	}
+	defer out.Body.Close()
+
+	content, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to read state object %s/%s", b.bucket, b.key)
+	}
+	return content, aws.StringValue(out.ETag), nil
+}
+
+// Write puts the state object if its ETag is still the given version
+func (b *S3Backend) Write(ctx context.Context, content []byte, version string) (string, error) {
+	req, out := b.client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(b.key),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String("application/json"),
+	})
+	req.SetContext(ctx)
+	// the conditional headers aren't part of this sdk version's input
+	if version == "" {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	} else {
+		req.HTTPRequest.Header.Set("If-Match", version)
+	}
+	err := req.Send()
+	// a concurrent conditional write is rejected with 409
+	if isStatus(err, http.StatusPreconditionFailed) || isStatus(err, http.StatusConflict) {
+		return "", ErrConflict
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to put state object %s/%s", b.bucket, b.key)
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+func isStatus(err error, status int) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == status
+}
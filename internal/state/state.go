@@ -5,6 +5,8 @@ import "github.com/threefoldtech/tfgrid-sdk-go/grid-client/state"
 
 // State struct
 type State struct {
+	// Version is the version of the state document, see CurrentVersion
+	Version  int                `json:"version"`
 	Networks state.NetworkState `json:"networks"`
 }
 
@@ -19,6 +21,7 @@ func (s *State) GetNetworkState() state.NetworkState {
 // NewState generates a new state
 func NewState() State {
 	return State{
+		Version:  CurrentVersion,
 		Networks: make(state.NetworkState),
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 
@@ -34,12 +35,8 @@ func main() {
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
+	// the state is loaded once the provider is configured, as its path depends on the configuration
 	stateFile := state.NewLocalFileState()
-	err := stateFile.Load(state.FileName)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
 	providerFunc, sub := provider.New(version, &stateFile)
 	if sub != nil {
 		defer sub.Close()
@@ -55,7 +52,10 @@ func main() {
 	}
 
 	plugin.Serve(opts)
-	err = stateFile.Save(state.FileName)
+	if !stateFile.Opened() {
+		return
+	}
+	err := stateFile.Save(context.Background())
 	if err != nil {
 		log.Fatal(err.Error())
 	}